@@ -10,6 +10,7 @@ import (
 	"github.com/golang/glog"
 
 	"github.com/coreos/container-linux-update-operator/pkg/agent"
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
 	"github.com/coreos/container-linux-update-operator/pkg/version"
 )
 
@@ -17,6 +18,7 @@ var (
 	node         = flag.String("node", "", "Kubernetes node name")
 	printVersion = flag.Bool("version", false, "Print version and exit")
 	reapTimeout  = flag.Int("grace-period", 600, "Period of time in seconds given to a pod to terminate when rebooting for an update")
+	prefix       = flag.String("annotation-prefix", constants.DefaultPrefix, "Prefix of the node labels and annotations used to coordinate with the update-operator, which must use the same prefix")
 )
 
 func main() {
@@ -36,6 +38,10 @@ func main() {
 		glog.Fatal("-node is required")
 	}
 
+	if err := constants.SetPrefix(*prefix); err != nil {
+		glog.Fatalf("Failed to set annotation prefix: %v", err)
+	}
+
 	rt := time.Duration(*reapTimeout) * time.Second
 	a, err := agent.New(*node, rt)
 	if err != nil {
@@ -4,23 +4,103 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/coreos/pkg/flagutil"
 	"github.com/golang/glog"
+	"k8s.io/client-go/kubernetes"
 
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
 	"github.com/coreos/container-linux-update-operator/pkg/k8sutil"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
 	"github.com/coreos/container-linux-update-operator/pkg/operator"
 	"github.com/coreos/container-linux-update-operator/pkg/version"
 )
 
 var (
+	nodes                   flagutil.StringSliceFlag
 	beforeRebootAnnotations flagutil.StringSliceFlag
 	afterRebootAnnotations  flagutil.StringSliceFlag
-	kubeconfig              = flag.String("kubeconfig", "", "Path to a kubeconfig file. Default to the in-cluster config if not provided.")
+	rebootPredicates        flagutil.StringSliceFlag
+	rebootReasonPolicies    flagutil.StringSliceFlag
+	rebootFreezes           flagutil.StringSliceFlag
+	kubeconfig              = flag.String("kubeconfig", "", "Path to a kubeconfig file. Defaults to the KUBECONFIG environment variable and ~/.kube/config, then to the in-cluster config")
+	kubeContext             = flag.String("kube-context", "", "Context of the kubeconfig to use. Defaults to its current context")
+	namespace               = flag.String("namespace", "", "Namespace the operator runs in, e.g. for its leader election lock and pause ConfigMap. Defaults to the POD_NAMESPACE environment variable")
+	apiTimeout              = flag.Duration("api-timeout", time.Minute, "Timeout of each request to the apiserver, so a hung apiserver does not block the operator. Failed requests are retried on the next reconciliation. No timeout if 0")
 	autoLabelContainerLinux = flag.Bool("auto-label-container-linux", false, "Auto-label Container Linux nodes with agent=true (convenience)")
+	nodeSelector            = flag.String("node-selector", "", "Label selector for the nodes managed by the operator. E.g. 'pool=container-linux'. Defaults to all nodes")
 	rebootWindowStart       = flag.String("reboot-window-start", "", "Day of week ('Sun', 'Mon', ...; optional) and time of day at which the reboot window starts. E.g. 'Mon 14:00', '11:00'")
 	rebootWindowLength      = flag.String("reboot-window-length", "", "Length of the reboot window. E.g. '1h30m'")
+	operatorNode            = flag.String("operator-node", "", "Name of the node the operator runs on, which is only rebooted while no other node is rebooting or chosen to reboot, so the operator is not evicted while it coordinates their reboots. Defaults to the NODE_NAME environment variable")
+	rebootPolicy            = flag.String("reboot-policy", "", "Name of a RebootPolicy custom resource in the operator namespace whose reboot window, maximum rebooting nodes, node selector and reboot timeout override the flags, reloaded on every reconciliation. The flags apply while it does not exist. Disabled if empty")
+	rebootWindowTimezone    = flag.String("reboot-window-timezone", "", "IANA time zone the reboot window is interpreted in. E.g. 'UTC', 'America/New_York'. Defaults to the local time zone")
+	rebootMaxConcurrency    = flag.Int("reboot-max-concurrency", 1, "Maximum number of nodes allowed to reboot at the same time")
+	rebootMaxUnavailable    = flag.String("reboot-max-unavailable", "", "Maximum number of nodes allowed to reboot at the same time, either absolute or as a percentage of the schedulable nodes. E.g. '20%'. Can not be combined with --reboot-max-concurrency")
+	rebootOSVersion         = flag.String("reboot-os-version", "", "Only reboot the nodes updated to this Container Linux version, e.g. '1688.5.3', as set in their new-version annotation by the update-agent. All nodes if empty")
+	rebootNotReady          = flag.Bool("reboot-not-ready", false, "Also reboot nodes whose Ready condition is not True. By default such nodes are skipped")
+	rebootOrder             = flag.String("reboot-order", "oldest-first", "Order in which nodes wanting to reboot are considered: 'name', 'priority' by the reboot-priority annotation, highest first, or 'oldest-first' or 'newest-first' by the reboot-needed-time annotation set by the update-agent when requesting the reboot. Control-plane nodes are always considered last, and nodes which were chosen to reboot before and have not rebooted successfully since after the others")
+	batchLabel              = flag.String("batch-label", "", "Label key grouping nodes into reboot batches by its value, e.g. 'pool'. All nodes of a batch wanting to reboot are rebooted before any node of the next batch. Disabled if empty")
+	separateControlPlane    = flag.Bool("separate-control-plane", false, "Reboot all worker nodes before control-plane nodes, never rebooting both at the same time. The maximum concurrency applies to each separately")
+	minReadyNodes           = flag.Int("min-ready-nodes", 0, "Minimum number of Ready, schedulable nodes which are not rebooting. A node is not allowed to reboot if this would leave fewer of them. Disabled if 0")
+	maxRebootingPerZone     = flag.Int("reboot-max-concurrency-per-zone", 0, "Maximum number of nodes in the same zone, as set by the topology.kubernetes.io/zone label, allowed to reboot at the same time, in addition to reboot-max-concurrency. Unlimited if 0")
+	cleanupConcurrency      = flag.Int("cleanup-concurrency", 5, "Maximum number of nodes which completed their reboot updated at once by the after-reboot cleanup, so it keeps pace when many nodes complete their reboot together. Does not affect how many nodes reboot at once")
+	rebootMaxCandidates     = flag.Int("reboot-max-candidates", 50, "Maximum number of nodes wanting to reboot, in reboot order, evaluated for a reboot in each reconciliation, bounding the API requests made for their checks on large clusters")
+	etcdNodeSelector        = flag.String("etcd-node-selector", "", "Label selector for the nodes hosting etcd members, e.g. 'node-role.kubernetes.io/etcd'. At most etcd-max-concurrency of them reboot at the same time. Disabled if empty")
+	etcdMaxConcurrency      = flag.Int("etcd-max-concurrency", 1, "Maximum number of nodes hosting etcd members allowed to reboot at the same time, regardless of the reboot-max-concurrency")
+	beforeRebootHook        = flag.String("before-reboot-hook", "", "Command run with the node name as argument, and in NODE_NAME, before a node is allowed to reboot. The node is not rebooted until it succeeds")
+	postRebootDelay         = flag.Duration("post-reboot-delay", 0, "Period of time a node is left to settle after its reboot, once its after-reboot annotations are set, before the reboot is considered successful and the next node may reboot. Counts towards the reboot-timeout. Disabled if 0")
+	afterRebootPodSelector  = flag.String("after-reboot-pod-selector", "", "Label selector for the pods which must be ready on a node after its reboot before the reboot is considered successful, e.g. 'tier=critical'. A node whose pods are not ready within the reboot-timeout is reported as failed. Disabled if empty")
+	afterRebootHook         = flag.String("after-reboot-hook", "", "Command run with the node name as argument, and in NODE_NAME, after a node has rebooted. The reboot is only considered successful once it succeeds")
+	afterRebootHookKeep     = flag.Bool("after-reboot-hook-keep-cordoned", true, "Keep nodes whose after-reboot hook fails cordoned and retry the hook. If false, such nodes are released without their reboot being considered successful")
+	rebootPredicateTimeout  = flag.Duration("reboot-predicate-timeout", 30*time.Second, "Period of time a reboot predicate is given to complete for a node before it is killed and the node is deferred")
+	rebootHookTimeout       = flag.Duration("reboot-hook-timeout", 10*time.Minute, "Period of time a reboot hook is given to complete before it is killed and considered failed")
+	drainBeforeReboot       = flag.Bool("drain-before-reboot", false, "Cordon and evict pods from a node before allowing it to reboot")
+	drainMode               = flag.String("drain-mode", "drain", "How nodes are drained before they reboot: 'drain' to cordon them and evict their pods, or 'cordon-only' to only cordon them, so no new pods are scheduled on them, without evicting the running pods. 'cordon-only' implies --drain-before-reboot")
+	drainGracePeriod        = flag.Duration("drain-grace-period", 10*time.Minute, "Period of time given to an evicted pod to terminate when draining a node")
+	drainTimeout            = flag.Duration("drain-timeout", 0, "Period of time during which evictions refused because of a PodDisruptionBudget are retried when draining a node. Not retried if 0")
+	drainForce              = flag.Bool("drain-force", false, "Delete the pods which could not be evicted within the drain timeout, instead of deferring the reboot of their node")
+	rebootTaint             = flag.String("reboot-taint", "", "Taint, as 'key=value' or 'key', added with the NoSchedule effect to nodes before they reboot and removed after, instead of cordoning them when draining. E.g. 'example.com/rebooting=true'. Disabled if empty")
+	protectedPriority       = flag.String("protected-priority-class", "", "Name of a PriorityClass. Pods with at least its priority are never evicted, and the reboot of nodes running them is deferred. Disabled if empty")
+	rebootTimeout           = flag.Duration("reboot-timeout", time.Hour, "Period of time a node is given to complete its reboot after it has been allowed to reboot, before the reboot is reported as failed")
+	rebootMaxRetries        = flag.Int("reboot-max-retries", 0, "Number of times a node which did not complete its reboot within the reboot timeout is given another reboot timeout, before its reboot is reported as failed and the node is reset to request its reboot again")
+	forceRebootAfter        = flag.Duration("force-reboot-after", 0, "Uptime after which the operator requests a reboot of a node, even though its update-agent did not, e.g. to reboot nodes periodically for compliance. Disabled if 0")
+	rebootRequestTTL        = flag.Duration("reboot-request-ttl", 0, "Age after which reboot requests of nodes are ignored, as recorded by the update-agent, so stale requests do not cause needless reboots. Disabled if 0")
+	agentPodSelector        = flag.String("agent-pod-selector", "app=container-linux-update-agent", "Label selector for the update-agent pods, used to tell whether the update-agent of a node which failed to reboot is running")
+	agentMissingReset       = flag.Bool("agent-missing-reset", false, "Reset the reboot-needed annotation of nodes which failed to reboot while their update-agent is not running, so they are not selected again until their update-agent is back")
+	flappingReboots         = flag.Int("flapping-reboots", 0, "Number of reboots a node may complete within the flapping-window. A node wanting to reboot again after more reboots is excluded with the exclude annotation, and a RebootFlapping event recorded, instead of rebooting it in a loop. Disabled if 0")
+	flappingWindow          = flag.Duration("flapping-window", time.Hour, "Period of time over which the reboots of a node are counted for the flapping-reboots")
+	rebootCooldown          = flag.Duration("reboot-cooldown", 0, "Period of time to wait after a node completed its reboot before allowing another node to reboot, giving workloads time to reschedule")
+	maxRebootFailures       = flag.Int("max-reboot-failures", 0, "Number of consecutive failed reboots after which no more nodes are allowed to reboot, until the operator is restarted or its pause ConfigMap is annotated with reset-reboot-failures=true. Disabled if 0")
+	rebootBacklogThreshold  = flag.Int("reboot-backlog-threshold", 0, "Number of nodes wanting to reboot above which a RebootBacklog event is recorded and a warning logged, once the backlog lasted for the reboot-backlog-duration. Disabled if 0")
+	rebootBacklogDuration   = flag.Duration("reboot-backlog-duration", time.Hour, "Period of time the reboot backlog must exceed the reboot-backlog-threshold before it is reported, so transient spikes are not")
+	dryRun                  = flag.Bool("dry-run", false, "Log the changes which would be made to nodes, such as labels, annotations and evictions, without making them")
+	rebootStrategy          = flag.String("reboot-strategy", "reboot", "Reboot strategy of the operator, either 'reboot' or 'off'. With 'off', reboots in progress are completed and metrics and status are still reported, but no node is allowed to reboot, regardless of its reboot-strategy annotation")
+	rebootReasonDefault     = flag.String("reboot-reason-default-policy", "auto", "Policy applied to nodes wanting to reboot whose reboot reason matches none of the reboot-reason-policies: 'auto', 'approve' or 'defer'")
+	upgradeAnnotation       = flag.String("upgrade-annotation", "", "Annotation of the kube-system namespace which, while set to 'true', signals a cluster upgrade in progress, during which no node is allowed to reboot. Disabled if empty")
+	upgradeConfigMap        = flag.String("upgrade-configmap", "", "ConfigMap, as namespace/name, whose 'upgrade-in-progress' key, while set to 'true', signals a cluster upgrade in progress, during which no node is allowed to reboot. Disabled if empty")
+	disableCleanup          = flag.Bool("disable-cleanup", false, "Leave nodes which just rebooted alone, without setting reboot-ok=false, to observe the annotations set by the update-agent. For troubleshooting only: these nodes never complete their reboot")
+	reconcileQPS            = flag.Float64("reconcile-qps", 0.2, "Maximum number of reconciliations per second caused by node changes")
+	reconcileBurst          = flag.Int("reconcile-burst", 1, "Maximum burst of reconciliations caused by node changes")
+	reconcileJitter         = flag.Float64("reconcile-jitter", 0, "Maximum factor of the 30s reconciliation period randomly added to it, e.g. 0.5 for up to 15s, so operators restarted at the same time do not list nodes in lockstep. No jitter if 0")
+	eventNamespace          = flag.String("event-namespace", "", "Namespace to record events in. Defaults to the namespace of the object an event is about, 'default' for nodes")
+	eventSourceComponent    = flag.String("event-source-component", "update-operator", "Component name events are recorded as")
+	mirrorEvents            = flag.Bool("mirror-events", false, "Also record the RebootStarted, RebootSucceeded, RebootFailed and RebootDeferred events of nodes on the pod of the operator, named by the POD_NAME environment variable, for a single audit trail")
+	notifyWebhookURL        = flag.String("notify-webhook-url", "", "URL to post a JSON notification to when a node is allowed to reboot, completes its reboot or fails to, e.g. a Slack incoming webhook. Disabled if empty")
+	resultWebhookURL        = flag.String("result-webhook-url", "", "URL to post the result of each completed or failed reboot to as JSON, e.g. to run smoke tests. Failed deliveries are retried in the background without holding up reboots. Disabled if empty")
+	resultQueueSize         = flag.Int("result-queue-size", 100, "Maximum number of reboot results buffered while they are posted to the result-webhook-url. Further results are dropped and logged")
+	clusterName             = flag.String("cluster-name", "", "Identifier of the cluster included in notifications")
+	listenAddress           = flag.String("listen-address", "", "Address to serve Prometheus metrics on under /metrics, the health and readiness endpoints under /healthz and /readyz, and the reboot status of the nodes as JSON under /status. Disabled if empty")
+	tlsCertFile             = flag.String("tls-cert-file", "", "Certificate file to serve the listen-address with TLS. Requires tls-key-file. Plaintext if empty")
+	tlsKeyFile              = flag.String("tls-key-file", "", "Key file of the tls-cert-file")
+	tlsClientCAFile         = flag.String("tls-client-ca-file", "", "File of the CA certificates client certificates must be signed by to connect to the listen-address. Requires tls-cert-file. No client authentication if empty")
+	leaderElectionName      = flag.String("leader-election-lock-name", "container-linux-update-operator-lock", "Name of the ConfigMap used as leader election lock")
+	leaderElectionNamespace = flag.String("leader-election-lock-namespace", "", "Namespace of the ConfigMap used as leader election lock. Defaults to the namespace the operator runs in")
+	prefix                  = flag.String("annotation-prefix", constants.DefaultPrefix, "Prefix of the node labels and annotations used to coordinate with the update-agents, which must use the same prefix")
+	logFormat               = flag.String("log-format", logging.FormatText, "Format of the logs of the operator, 'text' for glog formatted logs or 'json' for JSON logs with fields such as the node name and reboot phase")
 	printVersion            = flag.Bool("version", false, "Print version and exit")
 	// deprecated
 	analyticsEnabled optValue
@@ -29,8 +109,12 @@ var (
 )
 
 func main() {
+	flag.Var(&nodes, "nodes", "List of comma-separated names of the only nodes managed by the operator, which must also match the node-selector. E.g. canary nodes. Defaults to all nodes")
 	flag.Var(&beforeRebootAnnotations, "before-reboot-annotations", "List of comma-separated Kubernetes node annotations that must be set to 'true' before a reboot is allowed")
 	flag.Var(&afterRebootAnnotations, "after-reboot-annotations", "List of comma-separated Kubernetes node annotations that must be set to 'true' before a node is marked schedulable and the operator lock is released")
+	flag.Var(&rebootFreezes, "reboot-freeze", "List of comma-separated start/end periods during which no node is allowed to reboot, regardless of the reboot window, e.g. '2017-12-22/2018-01-02'. Dates are interpreted in the reboot-window-timezone and the end date is included. RFC 3339 times may be given instead")
+	flag.Var(&rebootReasonPolicies, "reboot-reason-policies", "List of comma-separated prefix=policy pairs applied to nodes wanting to reboot by their reboot reason, with the longest matching prefix applying: 'auto' reboots the node like any node, 'approve' only once its reboot-approval annotation is set to granted, and 'defer' never")
+	flag.Var(&rebootPredicates, "reboot-predicates", "List of comma-separated commands or URLs, run like the before-reboot hook, which must all succeed for a node wanting to reboot to be chosen to reboot, in addition to the built-in ready and pod disruption budget predicates")
 	flag.Var(&analyticsEnabled, "analytics", "Send analytics to Google Analytics")
 
 	flag.Set("logtostderr", "true")
@@ -40,13 +124,16 @@ func main() {
 		glog.Fatalf("Failed to parse environment variables: %v", err)
 	}
 
-	if analyticsEnabled.present {
-		glog.Warning("Use of -analytics is deprecated and will be removed. Google Analytics will not be enabled.")
+	if err := logging.SetFormat(*logFormat); err != nil {
+		glog.Fatalf("Failed to set log format: %v", err)
 	}
 
-	// respect KUBECONFIG without the prefix as well
-	if *kubeconfig == "" {
-		*kubeconfig = os.Getenv("KUBECONFIG")
+	if err := constants.SetPrefix(*prefix); err != nil {
+		glog.Fatalf("Failed to set annotation prefix: %v", err)
+	}
+
+	if analyticsEnabled.present {
+		logging.Warning("Use of -analytics is deprecated and will be removed. Google Analytics will not be enabled.")
 	}
 
 	if *printVersion {
@@ -55,39 +142,171 @@ func main() {
 	}
 
 	if *manageAgent {
-		glog.Warning("Use of -manage-agent=true is deprecated and will be removed in the future")
+		logging.Warning("Use of -manage-agent=true is deprecated and will be removed in the future")
+	}
+
+	// the default maximum concurrency does not conflict with a maximum
+	// number of unavailable nodes, only a configured one does
+	maxRebootingNodes := *rebootMaxConcurrency
+	if !isFlagSet("reboot-max-concurrency") {
+		maxRebootingNodes = 0
 	}
 
 	// create Kubernetes client (clientset)
-	client, err := k8sutil.GetClient(*kubeconfig)
+	client, err := k8sutil.GetClientWithTimeout(*kubeconfig, *kubeContext, *apiTimeout)
 	if err != nil {
 		glog.Fatalf("Failed to create Kubernetes client: %v", err)
 	}
 
+	// request reboots of nodes instead of running the operator
+	if flag.Arg(0) == "reboot" {
+		requestReboots(client, flag.Args()[1:])
+		return
+	}
+
+	// elect the leader in the cluster the operator runs in, or in the
+	// cluster it manages when running out of cluster, e.g. in development
+	var leaderElectionClient kubernetes.Interface
+	if !k8sutil.InCluster() {
+		leaderElectionClient = client
+	}
+
 	// update-operator
 	o, err := operator.New(operator.Config{
-		Client:                  client,
-		AutoLabelContainerLinux: *autoLabelContainerLinux,
-		ManageAgent:             *manageAgent,
-		AgentImageRepo:          *agentImageRepo,
-		BeforeRebootAnnotations: beforeRebootAnnotations,
-		AfterRebootAnnotations:  afterRebootAnnotations,
-		RebootWindowStart:       *rebootWindowStart,
-		RebootWindowLength:      *rebootWindowLength,
+		Client:                      client,
+		ClientTimeout:               *apiTimeout,
+		LeaderElectionClient:        leaderElectionClient,
+		Namespace:                   *namespace,
+		OperatorNode:                *operatorNode,
+		AutoLabelContainerLinux:     *autoLabelContainerLinux,
+		NodeSelector:                *nodeSelector,
+		Nodes:                       nodes,
+		ManageAgent:                 *manageAgent,
+		AgentImageRepo:              *agentImageRepo,
+		BeforeRebootAnnotations:     beforeRebootAnnotations,
+		AfterRebootAnnotations:      afterRebootAnnotations,
+		AfterRebootPodSelector:      *afterRebootPodSelector,
+		PostRebootDelay:             *postRebootDelay,
+		RebootWindowStart:           *rebootWindowStart,
+		RebootWindowLength:          *rebootWindowLength,
+		RebootWindowTimezone:        *rebootWindowTimezone,
+		RebootFreezes:               rebootFreezes,
+		RebootPolicy:                *rebootPolicy,
+		MaxRebootingNodes:           maxRebootingNodes,
+		MaxUnavailable:              *rebootMaxUnavailable,
+		RebootNotReady:              *rebootNotReady,
+		RebootOSVersion:             *rebootOSVersion,
+		RebootOrder:                 *rebootOrder,
+		SeparateControlPlane:        *separateControlPlane,
+		BatchLabel:                  *batchLabel,
+		MinReadyNodes:               *minReadyNodes,
+		MaxRebootingNodesPerZone:    *maxRebootingPerZone,
+		MaxRebootCandidates:         *rebootMaxCandidates,
+		CleanupConcurrency:          *cleanupConcurrency,
+		EtcdNodeSelector:            *etcdNodeSelector,
+		EtcdMaxConcurrency:          *etcdMaxConcurrency,
+		RebootPredicates:            rebootPredicates,
+		RebootPredicateTimeout:      *rebootPredicateTimeout,
+		BeforeRebootHook:            *beforeRebootHook,
+		AfterRebootHook:             *afterRebootHook,
+		AfterRebootHookKeepCordoned: *afterRebootHookKeep,
+		RebootHookTimeout:           *rebootHookTimeout,
+		DrainBeforeReboot:           *drainBeforeReboot,
+		DrainMode:                   *drainMode,
+		DrainGracePeriod:            *drainGracePeriod,
+		DrainTimeout:                *drainTimeout,
+		DrainForce:                  *drainForce,
+		ProtectedPriorityClass:      *protectedPriority,
+		RebootTaint:                 *rebootTaint,
+		RebootTimeout:               *rebootTimeout,
+		RebootCooldown:              *rebootCooldown,
+		FlappingReboots:             *flappingReboots,
+		FlappingWindow:              *flappingWindow,
+		MaxRebootFailures:           *maxRebootFailures,
+		ForceRebootAfter:            *forceRebootAfter,
+		RebootRequestTTL:            *rebootRequestTTL,
+		AgentPodSelector:            *agentPodSelector,
+		AgentMissingReset:           *agentMissingReset,
+		RebootMaxRetries:            *rebootMaxRetries,
+		RebootBacklogThreshold:      *rebootBacklogThreshold,
+		RebootBacklogDuration:       *rebootBacklogDuration,
+		DryRun:                      *dryRun,
+		RebootStrategy:              *rebootStrategy,
+		UpgradeAnnotation:           *upgradeAnnotation,
+		UpgradeConfigMap:            *upgradeConfigMap,
+		RebootReasonPolicies:        rebootReasonPolicies,
+		RebootReasonDefaultPolicy:   *rebootReasonDefault,
+		DisableCleanup:              *disableCleanup,
+		ReconcileQPS:                float32(*reconcileQPS),
+		ReconcileBurst:              *reconcileBurst,
+		ReconcileJitter:             *reconcileJitter,
+		EventNamespace:              *eventNamespace,
+		EventSourceComponent:        *eventSourceComponent,
+		MirrorEvents:                *mirrorEvents,
+		NotifyWebhookURL:            *notifyWebhookURL,
+		ResultWebhookURL:            *resultWebhookURL,
+		ResultQueueSize:             *resultQueueSize,
+		ClusterName:                 *clusterName,
+		ListenAddress:               *listenAddress,
+		TLSCertFile:                 *tlsCertFile,
+		TLSKeyFile:                  *tlsKeyFile,
+		TLSClientCAFile:             *tlsClientCAFile,
+		LeaderElectionName:          *leaderElectionName,
+		LeaderElectionNamespace:     *leaderElectionNamespace,
 	})
 	if err != nil {
 		glog.Fatalf("Failed to initialize %s: %v", os.Args[0], err)
 	}
 
-	glog.Infof("%s running", os.Args[0])
+	logging.Infof("%s running", os.Args[0])
 
-	// Run operator until the stop channel is closed
+	// Run operator until the stop channel is closed, which happens when a
+	// SIGTERM or SIGINT is received
 	stop := make(chan struct{})
-	defer close(stop)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		logging.Infof("Received %v, shutting down", sig)
+		close(stop)
+	}()
 
 	if err := o.Run(stop); err != nil {
 		glog.Fatalf("Error while running %s: %v", os.Args[0], err)
 	}
+
+	logging.Infof("%s stopped", os.Args[0])
+}
+
+// requestReboots requests a reboot of each of the named nodes, which are then
+// rebooted by the running operator like any node requesting a reboot.
+func requestReboots(client kubernetes.Interface, names []string) {
+	if len(names) == 0 {
+		glog.Fatalf("Usage: %s [flags] reboot NODE...", os.Args[0])
+	}
+	for _, name := range names {
+		requested, err := operator.RequestReboot(client, name)
+		if err != nil {
+			glog.Fatalf("%v", err)
+		}
+		if requested {
+			logging.Infof("Requested a reboot of node %q", name)
+		} else {
+			logging.Infof("Node %q already requested a reboot or is rebooting", name)
+		}
+	}
+}
+
+// isFlagSet returns true if the named flag was set on the command line or
+// through the environment.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
 // optValue is a flag.Value that detects whether a user passed a flag directly.
@@ -33,13 +33,6 @@ type Klocksmith struct {
 
 const defaultPollInterval = 10 * time.Second
 
-var (
-	shouldRebootSelector = fields.Set(map[string]string{
-		constants.AnnotationOkToReboot:   constants.True,
-		constants.AnnotationRebootNeeded: constants.True,
-	}).AsSelector()
-)
-
 func New(node string, reapTimeout time.Duration) (*Klocksmith, error) {
 	// set up kubernetes in-cluster client
 	kc, err := k8sutil.GetClient("")
@@ -95,8 +88,22 @@ func (k *Klocksmith) process(stop <-chan struct{}) error {
 	labels := map[string]string{
 		constants.LabelRebootNeeded: constants.False,
 	}
+	// publish when we booted, so the operator may force a reboot of nodes
+	// which have been up for too long
+	if bt, err := k8sutil.GetBootTime(); err != nil {
+		glog.Warningf("Failed to get boot time: %v", err)
+	} else {
+		anno[constants.AnnotationBootTime] = bt.UTC().Format(time.RFC3339)
+	}
 	glog.Infof("Setting annotations %#v", anno)
-	if err := k8sutil.SetNodeAnnotationsLabels(k.nc, k.node, anno, labels); err != nil {
+	err := k8sutil.UpdateNodeRetry(k.nc, k.node, func(n *v1.Node) {
+		// before the reboot state of the previous agent is reset
+		adoptLegacyCordon(n)
+		setAnnotationsLabels(n, anno, labels)
+		// no reboot is requested anymore
+		delete(n.Annotations, constants.AnnotationRebootNeededTime)
+	})
+	if err != nil {
 		return err
 	}
 
@@ -106,9 +113,8 @@ func (k *Klocksmith) process(stop <-chan struct{}) error {
 		return err
 	}
 
-	// we are schedulable now.
-	glog.Info("Marking node as schedulable")
-	if err := k8sutil.Unschedulable(k.nc, k.node, false); err != nil {
+	// we are schedulable now, unless someone else cordoned us.
+	if err := k.uncordon(); err != nil {
 		return err
 	}
 
@@ -144,7 +150,7 @@ func (k *Klocksmith) process(stop <-chan struct{}) error {
 	// ReplicationController, ReplicaSet, DaemonSet or Job')
 
 	glog.Info("Marking node as unschedulable")
-	if err := k8sutil.Unschedulable(k.nc, k.node, true); err != nil {
+	if err := k.cordon(); err != nil {
 		return err
 	}
 
@@ -191,6 +197,82 @@ func (k *Klocksmith) process(stop <-chan struct{}) error {
 	return nil
 }
 
+// cordon marks the node as unschedulable to drain it before its reboot. A node
+// which was schedulable is annotated as cordoned by the update-operator, so it
+// is uncordoned after its reboot. A node which was already unschedulable, e.g.
+// cordoned by an admin, is annotated as not cordoned by the update-operator,
+// unless the update-operator cordoned it, and left unschedulable after its
+// reboot.
+func (k *Klocksmith) cordon() error {
+	err := k8sutil.UpdateNodeRetry(k.nc, k.node, func(n *v1.Node) {
+		if n.Annotations == nil {
+			n.Annotations = map[string]string{}
+		}
+		if n.Spec.Unschedulable {
+			if _, ok := n.Annotations[constants.AnnotationCordonedByOperator]; !ok {
+				n.Annotations[constants.AnnotationCordonedByOperator] = constants.False
+			}
+			return
+		}
+		n.Spec.Unschedulable = true
+		n.Annotations[constants.AnnotationCordonedByOperator] = constants.True
+	})
+	if err != nil {
+		return fmt.Errorf("unable to mark node %q as unschedulable: %v", k.node, err)
+	}
+	return nil
+}
+
+// uncordon marks the node as schedulable if it was cordoned by the
+// update-operator or agent to reboot it, and removes the annotation recording
+// it. Nodes cordoned by anyone else are left unschedulable. So are nodes whose
+// reboot the update-operator has not completed yet: it uncordons them itself
+// once their after-reboot checks and hook passed.
+func (k *Klocksmith) uncordon() error {
+	err := k8sutil.UpdateNodeRetry(k.nc, k.node, func(n *v1.Node) {
+		cordoned, ok := n.Annotations[constants.AnnotationCordonedByOperator]
+		if !ok {
+			return
+		}
+		if n.Labels[constants.LabelAfterReboot] == constants.True || n.Annotations[constants.AnnotationOkToReboot] == constants.True {
+			glog.Info("Leaving node unschedulable until the update-operator completes its reboot")
+			return
+		}
+		if cordoned != constants.True {
+			delete(n.Annotations, constants.AnnotationCordonedByOperator)
+			return
+		}
+		glog.Info("Marking node as schedulable")
+		n.Spec.Unschedulable = false
+		delete(n.Annotations, constants.AnnotationCordonedByOperator)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to mark node %q as schedulable: %v", k.node, err)
+	}
+	return nil
+}
+
+// adoptLegacyCordon annotates the given node as cordoned by the
+// update-operator if it was cordoned by an update-agent which did not record
+// it, i.e. a version older than this one which rebooted the node: the node is
+// unschedulable and still in its reboot, without any cordoned-by-operator
+// annotation, which this version sets whenever it cordons a node. As older
+// versions uncordoned nodes after their reboot unconditionally, the node is
+// then uncordoned like one cordoned by this version.
+func adoptLegacyCordon(n *v1.Node) {
+	if !n.Spec.Unschedulable {
+		return
+	}
+	if _, ok := n.Annotations[constants.AnnotationCordonedByOperator]; ok {
+		return
+	}
+	if n.Annotations[constants.AnnotationRebootInProgress] != constants.True && n.Annotations[constants.AnnotationOkToReboot] != constants.True {
+		return
+	}
+	glog.Info("Node was cordoned to reboot by an older update-agent, uncordoning it after its reboot")
+	n.Annotations[constants.AnnotationCordonedByOperator] = constants.True
+}
+
 // updateStatusCallback receives Status messages from update engine. If the
 // status is UpdateStatusUpdatedNeedReboot, indicate that with a label on our
 // node.
@@ -206,14 +288,23 @@ func (k *Klocksmith) updateStatusCallback(s updateengine.Status) {
 	labels := map[string]string{}
 
 	// indicate we need a reboot
-	if s.CurrentOperation == updateengine.UpdateStatusUpdatedNeedReboot {
+	needReboot := s.CurrentOperation == updateengine.UpdateStatusUpdatedNeedReboot
+	if needReboot {
 		glog.Info("Indicating a reboot is needed")
 		anno[constants.AnnotationRebootNeeded] = constants.True
+		anno[constants.AnnotationRebootReason] = fmt.Sprintf("update to version %s", s.NewVersion)
 		labels[constants.LabelRebootNeeded] = constants.True
 	}
+	requested := time.Now().UTC().Format(time.RFC3339)
 
 	wait.PollUntil(defaultPollInterval, func() (bool, error) {
-		if err := k8sutil.SetNodeAnnotationsLabels(k.nc, k.node, anno, labels); err != nil {
+		err := k8sutil.UpdateNodeRetry(k.nc, k.node, func(n *v1.Node) {
+			if needReboot {
+				stampRebootNeededTime(n, requested)
+			}
+			setAnnotationsLabels(n, anno, labels)
+		})
+		if err != nil {
 			glog.Errorf("Failed to set annotation %q: %v", constants.AnnotationStatus, err)
 			return false, nil
 		}
@@ -222,6 +313,38 @@ func (k *Klocksmith) updateStatusCallback(s updateengine.Status) {
 	}, wait.NeverStop)
 }
 
+// stampRebootNeededTime sets the reboot-needed-time annotation of the given
+// node to the given time, unless a reboot was already requested, so the time
+// of the request is kept when the update_engine status is sent again, e.g.
+// when the agent restarts. The reboot request TTL and the reboot order of the
+// update-operator rely on it.
+func stampRebootNeededTime(n *v1.Node, requested string) {
+	if n.Annotations[constants.AnnotationRebootNeeded] == constants.True && n.Annotations[constants.AnnotationRebootNeededTime] != "" {
+		return
+	}
+	if n.Annotations == nil {
+		n.Annotations = map[string]string{}
+	}
+	n.Annotations[constants.AnnotationRebootNeededTime] = requested
+}
+
+// setAnnotationsLabels sets all keys in a and l to their values in the
+// annotations and labels of the given node, respectively.
+func setAnnotationsLabels(n *v1.Node, a, l map[string]string) {
+	if n.Annotations == nil {
+		n.Annotations = map[string]string{}
+	}
+	if n.Labels == nil {
+		n.Labels = map[string]string{}
+	}
+	for k, v := range a {
+		n.Annotations[k] = v
+	}
+	for k, v := range l {
+		n.Labels[k] = v
+	}
+}
+
 // setInfoLabels labels our node with helpful info about Container Linux.
 func (k *Klocksmith) setInfoLabels() error {
 	vi, err := k8sutil.GetVersionInfo()
@@ -280,7 +403,7 @@ func (k *Klocksmith) waitForOkToReboot() error {
 
 	// hopefully 24 hours is enough time between indicating we need a
 	// reboot and the controller telling us to do it
-	ev, err := watch.Until(time.Hour*24, watcher, k8sutil.NodeAnnotationCondition(shouldRebootSelector))
+	ev, err := watch.Until(time.Hour*24, watcher, k8sutil.AllConditions(okToRebootConditions()...))
 	if err != nil {
 		return fmt.Errorf("waiting for annotation %q failed: %v", constants.AnnotationOkToReboot, err)
 	}
@@ -320,24 +443,7 @@ func (k *Klocksmith) waitForNotOkToReboot() error {
 	// Within 24 hours of indicating we don't need a reboot we should be given a not-ok.
 	// If that isn't the case, it likely means the operator isn't running, and
 	// we'll just crash-loop in that case, and hopefully that will help the user realize something's wrong.
-	// Use a custom condition function to use the more correct 'OkToReboot !=
-	// true' vs '== False'; due to the operator matching on '== True', and not
-	// going out of its way to convert '' => 'False', checking the exact inverse
-	// of what the operator checks is the correct thing to do.
-	ev, err := watch.Until(time.Hour*24, watcher, watch.ConditionFunc(func(event watch.Event) (bool, error) {
-		switch event.Type {
-		case watch.Error:
-			return false, fmt.Errorf("error watching node: %v", event.Object)
-		case watch.Deleted:
-			return false, fmt.Errorf("our node was deleted while we were waiting for ready")
-		}
-
-		no := event.Object.(*v1.Node)
-		if no.Annotations[constants.AnnotationOkToReboot] != constants.True {
-			return true, nil
-		}
-		return false, nil
-	}))
+	ev, err := watch.Until(time.Hour*24, watcher, k8sutil.AllConditions(notOkToRebootConditions()...))
 	if err != nil {
 		return fmt.Errorf("waiting for annotation %q failed: %v", constants.AnnotationOkToReboot, err)
 	}
@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+)
+
+// newTestKlocksmith returns an agent running on the given node, with a fake
+// clientset.
+func newTestKlocksmith(node *v1.Node) *Klocksmith {
+	kc := fake.NewSimpleClientset(node)
+	return &Klocksmith{node: node.Name, kc: kc, nc: kc.CoreV1().Nodes()}
+}
+
+func (k *Klocksmith) getNode(t *testing.T) *v1.Node {
+	n, err := k.nc.Get(k.node, v1meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get node %q: %v", k.node, err)
+	}
+	return n
+}
+
+func TestCordon(t *testing.T) {
+	tests := []struct {
+		name          string
+		unschedulable bool
+		// wanted cordoned-by-operator annotation
+		wantCordonedByOperator string
+	}{
+		{"schedulable", false, constants.True},
+		{"cordoned by an admin", true, constants.False},
+	}
+	for _, tt := range tests {
+		k := newTestKlocksmith(&v1.Node{
+			ObjectMeta: v1meta.ObjectMeta{Name: "node"},
+			Spec:       v1.NodeSpec{Unschedulable: tt.unschedulable},
+		})
+		if err := k.cordon(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+
+		n := k.getNode(t)
+		if !n.Spec.Unschedulable {
+			t.Errorf("%s: expected node to be unschedulable", tt.name)
+		}
+		if got := n.Annotations[constants.AnnotationCordonedByOperator]; got != tt.wantCordonedByOperator {
+			t.Errorf("%s: expected cordoned-by-operator %q, got %q", tt.name, tt.wantCordonedByOperator, got)
+		}
+	}
+}
+
+func TestUncordon(t *testing.T) {
+	tests := []struct {
+		name              string
+		labels            map[string]string
+		annotations       map[string]string
+		wantUnschedulable bool
+		// whether the node is still annotated as cordoned by the
+		// update-operator
+		wantCordonedByOperator bool
+	}{
+		{
+			name:        "cordoned by the operator",
+			annotations: map[string]string{constants.AnnotationCordonedByOperator: constants.True},
+		},
+		{
+			name:              "cordoned by an admin",
+			wantUnschedulable: true,
+		},
+		{
+			name:              "cordoned by an admin before the reboot",
+			annotations:       map[string]string{constants.AnnotationCordonedByOperator: constants.False},
+			wantUnschedulable: true,
+		},
+		{
+			name:   "after-reboot checks pending",
+			labels: map[string]string{constants.LabelAfterReboot: constants.True},
+			annotations: map[string]string{
+				constants.AnnotationCordonedByOperator: constants.True,
+				constants.AnnotationOkToReboot:         constants.True,
+			},
+			wantUnschedulable:      true,
+			wantCordonedByOperator: true,
+		},
+	}
+	for _, tt := range tests {
+		k := newTestKlocksmith(&v1.Node{
+			ObjectMeta: v1meta.ObjectMeta{Name: "node", Labels: tt.labels, Annotations: tt.annotations},
+			Spec:       v1.NodeSpec{Unschedulable: true},
+		})
+		if err := k.uncordon(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+
+		n := k.getNode(t)
+		if n.Spec.Unschedulable != tt.wantUnschedulable {
+			t.Errorf("%s: expected unschedulable %v, got %v", tt.name, tt.wantUnschedulable, n.Spec.Unschedulable)
+		}
+		if got := n.Annotations[constants.AnnotationCordonedByOperator] == constants.True; got != tt.wantCordonedByOperator {
+			t.Errorf("%s: expected cordoned by operator %v, got %v", tt.name, tt.wantCordonedByOperator, got)
+		}
+	}
+}
+
+func TestAdoptLegacyCordon(t *testing.T) {
+	tests := []struct {
+		name          string
+		unschedulable bool
+		annotations   map[string]string
+		// wanted cordoned-by-operator annotation, "" if missing
+		want string
+	}{
+		{
+			name:          "cordoned by an older agent",
+			unschedulable: true,
+			annotations:   map[string]string{constants.AnnotationRebootInProgress: constants.True},
+			want:          constants.True,
+		},
+		{
+			name:          "allowed to reboot by the operator",
+			unschedulable: true,
+			annotations:   map[string]string{constants.AnnotationOkToReboot: constants.True},
+			want:          constants.True,
+		},
+		{
+			name:          "cordoned by an admin",
+			unschedulable: true,
+			annotations:   map[string]string{constants.AnnotationRebootInProgress: constants.False},
+		},
+		{
+			name:          "cordoned by an admin before a reboot",
+			unschedulable: true,
+			annotations: map[string]string{
+				constants.AnnotationRebootInProgress:   constants.True,
+				constants.AnnotationCordonedByOperator: constants.False,
+			},
+			want: constants.False,
+		},
+		{
+			name:        "schedulable",
+			annotations: map[string]string{constants.AnnotationRebootInProgress: constants.True},
+		},
+	}
+	for _, tt := range tests {
+		n := &v1.Node{
+			ObjectMeta: v1meta.ObjectMeta{Name: "node", Annotations: tt.annotations},
+			Spec:       v1.NodeSpec{Unschedulable: tt.unschedulable},
+		}
+		adoptLegacyCordon(n)
+		if got := n.Annotations[constants.AnnotationCordonedByOperator]; got != tt.want {
+			t.Errorf("%s: expected cordoned-by-operator %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestStampRebootNeededTime(t *testing.T) {
+	const requested = "2017-08-01T20:12:05Z"
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        string
+	}{
+		{"first request", nil, requested},
+		{
+			name: "reboot no longer needed",
+			annotations: map[string]string{
+				constants.AnnotationRebootNeeded:     constants.False,
+				constants.AnnotationRebootNeededTime: "2017-07-01T00:00:00Z",
+			},
+			want: requested,
+		},
+		{
+			name: "request without a time",
+			annotations: map[string]string{
+				constants.AnnotationRebootNeeded: constants.True,
+			},
+			want: requested,
+		},
+		{
+			name: "request sent again",
+			annotations: map[string]string{
+				constants.AnnotationRebootNeeded:     constants.True,
+				constants.AnnotationRebootNeededTime: "2017-07-01T00:00:00Z",
+			},
+			want: "2017-07-01T00:00:00Z",
+		},
+	}
+	for _, tt := range tests {
+		n := &v1.Node{ObjectMeta: v1meta.ObjectMeta{Name: "node", Annotations: tt.annotations}}
+		stampRebootNeededTime(n, requested)
+		if got := n.Annotations[constants.AnnotationRebootNeededTime]; got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package agent
+
+import (
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+	"github.com/coreos/container-linux-update-operator/pkg/k8sutil"
+)
+
+// okToRebootConditions returns the conditions the node must satisfy, all at
+// once, before the agent reboots it: the operator allowed the reboot, and the
+// node still needs it.
+func okToRebootConditions() []watch.ConditionFunc {
+	return []watch.ConditionFunc{
+		k8sutil.NodeAnnotationEqualsCondition(constants.AnnotationOkToReboot, constants.True),
+		k8sutil.NodeAnnotationEqualsCondition(constants.AnnotationRebootNeeded, constants.True),
+	}
+}
+
+// notOkToRebootConditions returns the conditions the node must satisfy, all
+// at once, before the agent considers its last reboot complete. The operator
+// matches reboot-ok on "true" without converting "" to "false", so the exact
+// inverse of what it checks is used.
+func notOkToRebootConditions() []watch.ConditionFunc {
+	return []watch.ConditionFunc{
+		k8sutil.NodeCondition(func(n *v1.Node) bool {
+			return n.Annotations[constants.AnnotationOkToReboot] != constants.True
+		}),
+	}
+}
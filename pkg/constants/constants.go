@@ -2,30 +2,181 @@
 // the update-agent and update-operator.
 package constants
 
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
 const (
 	// Annotation values used by update-agent and update-operator
 	True  = "true"
 	False = "false"
 
-	// Prefix used by all label and annotation keys.
-	Prefix = "container-linux-update.v1.coreos.com/"
+	// Values of AnnotationRebootPhase
+	RebootPhaseBeforeRebootChecks = "before-reboot-checks"
+	RebootPhaseDraining           = "draining"
+	RebootPhaseWaitingForReboot   = "waiting-for-reboot"
+	RebootPhaseAfterRebootChecks  = "after-reboot-checks"
+	RebootPhaseFailed             = "failed"
+
+	// Values of AnnotationRebootStrategy
+	RebootStrategyReboot   = "reboot"
+	RebootStrategyEtcdLock = "etcd-lock"
+	RebootStrategyOff      = "off"
+
+	// Values of AnnotationRebootApproval
+	RebootApprovalRequired = "required"
+	RebootApprovalGranted  = "granted"
+
+	// DefaultPrefix is the prefix used by all label and annotation keys,
+	// unless another one is set with SetPrefix.
+	DefaultPrefix = "container-linux-update.v1.coreos.com/"
+)
+
+var (
+	// Prefix used by all label and annotation keys, DefaultPrefix unless set
+	// with SetPrefix.
+	Prefix string
 
 	// Key set to "true" by the update-agent when a reboot is requested.
-	AnnotationRebootNeeded = Prefix + "reboot-needed"
-	LabelRebootNeeded      = Prefix + "reboot-needed"
+	AnnotationRebootNeeded string
+	LabelRebootNeeded      string
+
+	// Key set by the update-agent to the time, in RFC3339 format, at which it
+	// set AnnotationRebootNeeded to "true". It is not changed while the
+	// reboot is still needed, and removed once it is not.
+	AnnotationRebootNeededTime string
+
+	// Key set together with AnnotationRebootNeeded to a human readable reason
+	// the reboot is needed, e.g. "update to version 1688.5.3". Set by the
+	// update-agent, or by the update-operator when it requests the reboot.
+	// Removed by the update-operator once the reboot has completed.
+	AnnotationRebootReason string
 
 	// Key set to "true" by the update-agent when node-drain and reboot is
 	// initiated.
-	AnnotationRebootInProgress = Prefix + "reboot-in-progress"
+	AnnotationRebootInProgress string
 
 	// Key set to "true" by the update-operator when an agent may proceed
 	// with a node-drain and reboot.
-	AnnotationOkToReboot = Prefix + "reboot-ok"
+	AnnotationOkToReboot string
+
+	// Key set by the update-operator to the time, in RFC3339 format, at which
+	// it set AnnotationOkToReboot to "true". It is removed once the reboot has
+	// completed.
+	AnnotationOkToRebootTime string
+
+	// Key set by the update-operator to the time, in RFC3339 format, at which
+	// the last reboot of a node completed, when it releases the node after
+	// its after-reboot checks.
+	AnnotationLastReboot string
+
+	// Key set by the update-operator, with --flapping-reboots, to the times,
+	// in RFC3339 format and separated by commas, at which the recent reboots
+	// of a node completed, within the flapping window. Updated together with
+	// AnnotationLastReboot.
+	AnnotationRecentReboots string
+
+	// Key set by the update-operator to its build version, when it sets
+	// AnnotationOkToReboot to "true", so the last reboot of a node can be
+	// correlated with the version of the update-operator which coordinated
+	// it. It is kept after the reboot.
+	AnnotationRebootOperatorVersion string
+
+	// Key set to "true" by the update-operator or update-agent when it
+	// cordoned a node to drain it before a reboot, or to "false" when the
+	// node was already cordoned by someone else. Only nodes cordoned by them
+	// are uncordoned after the reboot, and the key is then removed. An
+	// update-agent adopts the unannotated nodes cordoned by older versions.
+	AnnotationCordonedByOperator string
+
+	// Key set by the update-operator to the key of the reboot taint it added
+	// to a node before a reboot. Only taints added by the update-operator are
+	// removed by it after the reboot, and the key is then removed.
+	AnnotationTaintedByOperator string
+
+	// Key set to "true" by the update-operator when it disabled the
+	// scale-down of a node by the cluster-autoscaler during a reboot. Only
+	// scale-downs disabled by the update-operator are enabled again by it
+	// after the reboot, and the key is then removed.
+	AnnotationScaleDownDisabledByOperator string
+
+	// Key set to "true" by the update-operator when it set
+	// AnnotationRebootApproval to RebootApprovalRequired on a node because of
+	// the policy for its reboot reason. Both keys are removed by it after the
+	// reboot.
+	AnnotationApprovalRequiredByOperator string
+
+	// Key set by the update-operator to the phase of the reboot of a node, so
+	// it is visible where a node is in its reboot. It is removed once the
+	// reboot has completed.
+	AnnotationRebootPhase string
 
 	// Key that may be set by the administrator to "true" to prevent
 	// update-operator from considering a node for rebooting.  Never set by
 	// the update-agent or update-operator.
-	AnnotationRebootPaused = Prefix + "reboot-paused"
+	AnnotationRebootPaused string
+
+	// Key that may be set by the administrator to "true" to exclude a node
+	// from all actions of the update-operator, e.g. for a manually managed
+	// node: it is neither rebooted, nor cleaned up, cordoned or labeled.
+	// Never set by the update-agent or update-operator.
+	AnnotationExclude string
+
+	// Key that may be set by the administrator to choose how the
+	// update-operator reboots a node. Never set by the update-agent or
+	// update-operator.
+	//
+	// Possible values are:
+	//  - RebootStrategyReboot, the default, reboots the node when allowed by
+	//    the update-operator configuration
+	//  - RebootStrategyEtcdLock additionally allows only one node with this
+	//    strategy to reboot at a time
+	//  - RebootStrategyOff never reboots the node
+	AnnotationRebootStrategy string
+
+	// Key that may be set by the administrator to an integer priority of a
+	// node. With the priority reboot order, nodes with a higher priority
+	// reboot first. Never set by the update-agent or update-operator.
+	AnnotationRebootPriority string
+
+	// Key that may be set by the administrator to a duration, e.g. "30m",
+	// overriding the reboot timeout of the update-operator for a node, e.g.
+	// for nodes which are slow to reboot. Never set by the update-agent or
+	// update-operator.
+	AnnotationRebootTimeout string
+
+	// Key that may be set by the administrator to RebootApprovalRequired on
+	// nodes which must not reboot until each reboot is approved, by setting it
+	// to RebootApprovalGranted. The update-operator sets it back to
+	// RebootApprovalRequired once the approved reboot has completed or failed.
+	AnnotationRebootApproval string
+
+	// Key that may be set by the administrator to a positive integer, the
+	// share of the maximum number of rebooting nodes the reboot of a node
+	// uses, e.g. 3 for a node hosting many pods. Defaults to 1. Never set by
+	// the update-agent or update-operator.
+	AnnotationRebootWeight string
+
+	// Key that may be set by the administrator to "true" to abort the reboot
+	// of a node which has not started to reboot yet. The update-operator
+	// resets its reboot request and removes the key.
+	AnnotationRebootAbort string
+
+	// Key that may be set by the administrator to "true" for an emergency
+	// reboot of a node, e.g. for a critical security update, bypassing the
+	// reboot freeze, the reboot window and the reboot cooldown. All other
+	// limits still apply. The update-operator removes the key once the reboot
+	// has completed.
+	AnnotationRebootEmergency string
+
+	// Key that may be set by the administrator to the name of a group of
+	// nodes, e.g. "database", of which only one node may reboot at a time,
+	// regardless of the maximum number of rebooting nodes. Never set by the
+	// update-agent or update-operator.
+	AnnotationSerialRebootGroup string
 
 	// Key set by the update-agent to the current operator status of update_agent.
 	//
@@ -40,42 +191,106 @@ const (
 	//  - "UPDATE_STATUS_REPORTING_ERROR_EVENT"
 	//
 	// It is possible, but extremely unlike for it to be "unknown status".
-	AnnotationStatus = Prefix + "status"
+	AnnotationStatus string
+
+	// Key set by the update-agent to the time, in RFC3339 format, at which the
+	// node booted.
+	AnnotationBootTime string
 
 	// Key set by the update-agent to LAST_CHECKED_TIME reported by update_engine.
 	//
 	// It is zero if an update has never been checked for, or a UNIX timestamp.
-	AnnotationLastCheckedTime = Prefix + "last-checked-time"
+	AnnotationLastCheckedTime string
 
 	// Key set by the update-agent to NEW_VERSION reported by update_engine.
 	//
 	// It is an opaque string, but might be semver.
-	AnnotationNewVersion = Prefix + "new-version"
+	AnnotationNewVersion string
 
 	// Keys set to true when the operator is waiting for configured annotation
 	// before and after the reboot repectively
-	LabelBeforeReboot = Prefix + "before-reboot"
-	LabelAfterReboot  = Prefix + "after-reboot"
+	LabelBeforeReboot string
+	LabelAfterReboot  string
 
 	// Key set by the update-agent to the value of "ID" in /etc/os-release.
-	LabelID = Prefix + "id"
+	LabelID string
 
 	// Key set by the update-agent to the value of "GROUP" in
 	// /usr/share/coreos/update.conf, overridden by the value of "GROUP" in
 	// /etc/coreos/update.conf.
-	LabelGroup = Prefix + "group"
+	LabelGroup string
 
 	// Key set by the update-agent to the value of "VERSION" in /etc/os-release.
-	LabelVersion = Prefix + "version"
+	LabelVersion string
 
 	// Label set to "true" on nodes where update-agent pods should be scheduled.
 	// This applies only when update-operator is run with the flag
 	// auto-label-container-linux=true
-	LabelUpdateAgentEnabled = Prefix + "agent"
+	LabelUpdateAgentEnabled string
 
 	// AgentVersion is the key used to indicate the
 	// container-linux-update-operator's agent's version.
 	// The value is a semver-parseable string. It should be present on each agent
 	// pod, as well as on the daemonset that manages them.
-	AgentVersion = Prefix + "agent-version"
+	AgentVersion string
 )
+
+func init() {
+	setPrefix(DefaultPrefix)
+}
+
+// SetPrefix sets the prefix used by all label and annotation keys, e.g. to run
+// a renamed update-operator alongside another one. The prefix must be a DNS
+// subdomain followed by a slash. The update-agent and update-operator must
+// use the same prefix, and it must be set before any of the keys are used.
+func SetPrefix(prefix string) error {
+	if !strings.HasSuffix(prefix, "/") {
+		return fmt.Errorf("invalid prefix %q: must end with a slash", prefix)
+	}
+	if errs := validation.IsDNS1123Subdomain(strings.TrimSuffix(prefix, "/")); len(errs) > 0 {
+		return fmt.Errorf("invalid prefix %q: %s", prefix, strings.Join(errs, ", "))
+	}
+	setPrefix(prefix)
+	return nil
+}
+
+// setPrefix sets Prefix and all keys derived from it.
+func setPrefix(prefix string) {
+	Prefix = prefix
+	AnnotationRebootNeeded = prefix + "reboot-needed"
+	LabelRebootNeeded = prefix + "reboot-needed"
+	AnnotationRebootNeededTime = prefix + "reboot-needed-time"
+	AnnotationRebootReason = prefix + "reboot-reason"
+	AnnotationRebootInProgress = prefix + "reboot-in-progress"
+	AnnotationOkToReboot = prefix + "reboot-ok"
+	AnnotationOkToRebootTime = prefix + "reboot-ok-time"
+	AnnotationLastReboot = prefix + "last-reboot"
+	AnnotationRecentReboots = prefix + "recent-reboots"
+	AnnotationRebootOperatorVersion = prefix + "reboot-operator-version"
+	AnnotationCordonedByOperator = prefix + "cordoned-by-operator"
+	AnnotationTaintedByOperator = prefix + "tainted-by-operator"
+	AnnotationScaleDownDisabledByOperator = prefix + "scale-down-disabled-by-operator"
+	AnnotationApprovalRequiredByOperator = prefix + "approval-required-by-operator"
+	AnnotationRebootPhase = prefix + "reboot-phase"
+	AnnotationRebootPaused = prefix + "reboot-paused"
+	AnnotationExclude = prefix + "exclude"
+	AnnotationRebootStrategy = prefix + "reboot-strategy"
+	AnnotationRebootPriority = prefix + "reboot-priority"
+	AnnotationRebootTimeout = prefix + "reboot-timeout"
+	AnnotationRebootApproval = prefix + "reboot-approval"
+	AnnotationRebootWeight = prefix + "reboot-weight"
+	AnnotationRebootAbort = prefix + "reboot-abort"
+	AnnotationRebootEmergency = prefix + "reboot-emergency"
+	AnnotationSerialRebootGroup = prefix + "serial-reboot-group"
+	AnnotationStatus = prefix + "status"
+	AnnotationBootTime = prefix + "boot-time"
+	AnnotationLastCheckedTime = prefix + "last-checked-time"
+	AnnotationNewVersion = prefix + "new-version"
+	LabelBeforeReboot = prefix + "before-reboot"
+	LabelAfterReboot = prefix + "after-reboot"
+	LabelID = prefix + "id"
+	LabelGroup = prefix + "group"
+	LabelVersion = prefix + "version"
+	LabelUpdateAgentEnabled = prefix + "agent"
+	AgentVersion = prefix + "agent-version"
+}
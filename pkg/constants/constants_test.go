@@ -0,0 +1,30 @@
+package constants
+
+import "testing"
+
+func TestSetPrefix(t *testing.T) {
+	defer setPrefix(DefaultPrefix)
+
+	if err := SetPrefix("example.com/"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if AnnotationOkToReboot != "example.com/reboot-ok" {
+		t.Errorf("expected AnnotationOkToReboot to use the new prefix, got %q", AnnotationOkToReboot)
+	}
+	if LabelBeforeReboot != "example.com/before-reboot" {
+		t.Errorf("expected LabelBeforeReboot to use the new prefix, got %q", LabelBeforeReboot)
+	}
+}
+
+func TestSetPrefixInvalid(t *testing.T) {
+	defer setPrefix(DefaultPrefix)
+
+	for _, prefix := range []string{"", "/", "example.com", "Example.com/", "example com/"} {
+		if err := SetPrefix(prefix); err == nil {
+			t.Errorf("expected an error for prefix %q", prefix)
+		}
+	}
+	if Prefix != DefaultPrefix {
+		t.Errorf("expected an invalid prefix to leave the prefix unchanged, got %q", Prefix)
+	}
+}
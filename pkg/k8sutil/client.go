@@ -2,6 +2,8 @@ package k8sutil
 
 import (
 	"fmt"
+	"os"
+	"time"
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -18,6 +20,32 @@ func GetClient(path string) (*kubernetes.Clientset, error) {
 	return kubernetes.NewForConfig(conf)
 }
 
+// GetClientWithTimeout returns a Kubernetes client loaded like kubectl does,
+// from the kubeconfig path, or the KUBECONFIG environment variable and the
+// default kubeconfig file if the path is empty, falling back to the in-cluster
+// service account environment if none are found. The given context of the
+// kubeconfig is used, or its current context if empty.
+// Requests of the client fail if they do not complete within the given
+// timeout, so a hung apiserver cannot block its callers indefinitely. Watches
+// are closed after the timeout as well. No timeout if 0.
+func GetClientWithTimeout(path, context string, timeout time.Duration) (*kubernetes.Clientset, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = path
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	conf, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Kubernetes client config: %v", err)
+	}
+	conf.Timeout = timeout
+	return kubernetes.NewForConfig(conf)
+}
+
+// InCluster returns true if running in a pod of a Kubernetes cluster, i.e. the
+// in-cluster service account environment is available.
+func InCluster() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != "" && os.Getenv("KUBERNETES_SERVICE_PORT") != ""
+}
+
 // getClientConfig returns a Kubernetes client Config.
 func getClientConfig(path string) (*rest.Config, error) {
 	if path != "" {
@@ -0,0 +1,58 @@
+package k8sutil
+
+import (
+	"fmt"
+
+	v1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// NodeCondition returns a condition function that succeeds when a node being
+// watched is added or modified and matches. It fails when the node is deleted
+// or the watch reports an error.
+func NodeCondition(match func(*v1api.Node) bool) watch.ConditionFunc {
+	return func(event watch.Event) (bool, error) {
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			node, ok := event.Object.(*v1api.Node)
+			if !ok {
+				return false, fmt.Errorf("unexpected object in watch event: %#v", event.Object)
+			}
+			return match(node), nil
+		case watch.Deleted:
+			return false, fmt.Errorf("node was deleted while it was watched")
+		case watch.Error:
+			return false, fmt.Errorf("error watching node: %v", event.Object)
+		}
+
+		return false, fmt.Errorf("unhandled watch case for %#v", event)
+	}
+}
+
+// NodeAnnotationEqualsCondition returns a condition function that succeeds
+// when a node being watched has an annotation of key equal to value.
+func NodeAnnotationEqualsCondition(key, value string) watch.ConditionFunc {
+	return NodeCondition(func(node *v1api.Node) bool {
+		return node.Annotations[key] == value
+	})
+}
+
+// AllConditions returns a condition function that succeeds when all of the
+// given conditions succeed for the same event. It fails as soon as any of
+// them fails. Unlike conditions passed to watch.Until, which are satisfied
+// one after the other, the conditions must hold at the same time.
+func AllConditions(conditions ...watch.ConditionFunc) watch.ConditionFunc {
+	return func(event watch.Event) (bool, error) {
+		all := true
+		for _, condition := range conditions {
+			ok, err := condition(event)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				all = false
+			}
+		}
+		return all, nil
+	}
+}
@@ -0,0 +1,75 @@
+package k8sutil
+
+import (
+	"testing"
+
+	v1api "k8s.io/api/core/v1"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func nodeEvent(t watch.EventType, annotations map[string]string) watch.Event {
+	return watch.Event{
+		Type: t,
+		Object: &v1api.Node{
+			ObjectMeta: v1meta.ObjectMeta{Name: "node", Annotations: annotations},
+		},
+	}
+}
+
+func TestNodeAnnotationEqualsCondition(t *testing.T) {
+	condition := NodeAnnotationEqualsCondition("reboot-ok", "true")
+
+	tests := []struct {
+		event   watch.Event
+		ok      bool
+		wantErr bool
+	}{
+		{nodeEvent(watch.Modified, map[string]string{"reboot-ok": "true"}), true, false},
+		{nodeEvent(watch.Added, map[string]string{"reboot-ok": "true"}), true, false},
+		{nodeEvent(watch.Modified, map[string]string{"reboot-ok": "false"}), false, false},
+		{nodeEvent(watch.Modified, nil), false, false},
+		{nodeEvent(watch.Deleted, map[string]string{"reboot-ok": "true"}), false, true},
+		{watch.Event{Type: watch.Error, Object: &v1meta.Status{Message: "gone"}}, false, true},
+	}
+	for i, tt := range tests {
+		ok, err := condition(tt.event)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%d: expected error %v, got %v", i, tt.wantErr, err)
+		}
+		if ok != tt.ok {
+			t.Errorf("%d: expected %v, got %v", i, tt.ok, ok)
+		}
+	}
+}
+
+func TestAllConditions(t *testing.T) {
+	condition := AllConditions(
+		NodeAnnotationEqualsCondition("reboot-ok", "true"),
+		NodeAnnotationEqualsCondition("reboot-needed", "true"),
+	)
+
+	tests := []struct {
+		event   watch.Event
+		ok      bool
+		wantErr bool
+	}{
+		{nodeEvent(watch.Modified, map[string]string{"reboot-ok": "true", "reboot-needed": "true"}), true, false},
+		{nodeEvent(watch.Modified, map[string]string{"reboot-ok": "true", "reboot-needed": "false"}), false, false},
+		{nodeEvent(watch.Modified, map[string]string{"reboot-ok": "false", "reboot-needed": "true"}), false, false},
+		{nodeEvent(watch.Deleted, map[string]string{"reboot-ok": "true", "reboot-needed": "true"}), false, true},
+	}
+	for i, tt := range tests {
+		ok, err := condition(tt.event)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%d: expected error %v, got %v", i, tt.wantErr, err)
+		}
+		if ok != tt.ok {
+			t.Errorf("%d: expected %v, got %v", i, tt.ok, ok)
+		}
+	}
+
+	if ok, err := AllConditions()(nodeEvent(watch.Modified, nil)); !ok || err != nil {
+		t.Errorf("expected no conditions to succeed, got %v, %v", ok, err)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	v1api "k8s.io/api/core/v1"
@@ -19,6 +21,7 @@ const (
 	updateConfPath         = "/usr/share/coreos/update.conf"
 	updateConfOverridePath = "/etc/coreos/update.conf"
 	osReleasePath          = "/etc/os-release"
+	procStatPath           = "/proc/stat"
 )
 
 // NodeAnnotationCondition returns a condition function that succeeds when a
@@ -113,17 +116,11 @@ func DeleteNodeAnnotations(nc v1core.NodeInterface, node string, ks []string) er
 }
 
 // Unschedulable marks node as schedulable or unschedulable according to sched.
+// Like the other setters, it gets the node again before retrying a
+// conflicting update, so concurrent updates of the node are not overwritten.
 func Unschedulable(nc v1core.NodeInterface, node string, sched bool) error {
-	n, err := nc.Get(node, v1meta.GetOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to get node %q: %v", node, err)
-	}
-
-	n.Spec.Unschedulable = sched
-
-	if err := RetryOnConflict(DefaultBackoff, func() (err error) {
-		n, err = nc.Update(n)
-		return
+	if err := UpdateNodeRetry(nc, node, func(n *v1api.Node) {
+		n.Spec.Unschedulable = sched
 	}); err != nil {
 		return fmt.Errorf("unable to set 'Unschedulable' property of node %q to %t: %v", node, sched, err)
 	}
@@ -230,3 +227,31 @@ func GetVersionInfo() (*VersionInfo, error) {
 
 	return vi, nil
 }
+
+// GetBootTime returns the time the current system booted, as reported by the
+// kernel in /proc/stat.
+func GetBootTime() (time.Time, error) {
+	b, err := ioutil.ReadFile(procStatPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parseBootTime(string(b))
+}
+
+// parseBootTime returns the boot time from the "btime" line of the contents
+// of /proc/stat.
+func parseBootTime(stat string) (time.Time, error) {
+	sc := bufio.NewScanner(strings.NewReader(stat))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 || fields[0] != "btime" {
+			continue
+		}
+		btime, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid boot time %q: %v", fields[1], err)
+		}
+		return time.Unix(btime, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("no boot time found")
+}
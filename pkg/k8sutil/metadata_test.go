@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 
@@ -67,3 +68,18 @@ func TestUpdateNodeRetryHandlesConflict(t *testing.T) {
 		t.Errorf("expected the counter to hit 22; was %v", mockNode.Annotations["counter"])
 	}
 }
+
+func TestParseBootTime(t *testing.T) {
+	stat := "cpu  2255 34 2290 22625563 6290 127 456 0 0 0\nintr 1462898\nctxt 115315\nbtime 1501621325\nprocesses 4703\n"
+	bt, err := parseBootTime(stat)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bt.Equal(time.Unix(1501621325, 0)) {
+		t.Errorf("expected boot time %v, got %v", time.Unix(1501621325, 0), bt)
+	}
+
+	if _, err := parseBootTime("cpu  2255 34 2290\n"); err == nil {
+		t.Error("expected an error without a btime line")
+	}
+}
@@ -58,3 +58,13 @@ func FilterContainerLinuxNodes(nodes []v1api.Node) []v1api.Node {
 	}
 	return matches
 }
+
+// NodeReady returns true if the Ready condition of the node is True.
+func NodeReady(node *v1api.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1api.NodeReady {
+			return c.Status == v1api.ConditionTrue
+		}
+	}
+	return false
+}
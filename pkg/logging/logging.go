@@ -0,0 +1,193 @@
+// Package logging is a thin wrapper around glog which can also write logs as
+// JSON, with key/value fields, for log pipelines which cannot parse the glog
+// format.
+//
+// In the default text format, logs are written by glog and fields are omitted.
+// In the JSON format, each log line is a JSON object with the time, level and
+// message of the log line and its fields. Verbosity is controlled by the glog
+// -v flag in both formats.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+const (
+	levelInfo    = "info"
+	levelWarning = "warning"
+	levelError   = "error"
+)
+
+var (
+	// mu guards the settings below and writes to out
+	mu         sync.Mutex
+	jsonFormat bool
+	out        io.Writer = os.Stderr
+
+	std Logger
+)
+
+// SetFormat sets the format logs are written in, FormatText or FormatJSON.
+func SetFormat(format string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	switch format {
+	case "", FormatText:
+		jsonFormat = false
+	case FormatJSON:
+		jsonFormat = true
+	default:
+		return fmt.Errorf("unknown log format %q, must be %q or %q", format, FormatText, FormatJSON)
+	}
+	return nil
+}
+
+// Logger writes logs with a set of fields.
+type Logger struct {
+	fields map[string]interface{}
+}
+
+// With returns a logger with the given field.
+func With(key string, value interface{}) Logger {
+	return std.With(key, value)
+}
+
+// With returns a copy of the logger with the given field added.
+func (l Logger) With(key string, value interface{}) Logger {
+	fields := make(map[string]interface{}, len(l.fields)+1)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	return Logger{fields: fields}
+}
+
+func (l Logger) Info(args ...interface{}) {
+	l.output(1, levelInfo, fmt.Sprint(args...))
+}
+
+func (l Logger) Infof(format string, args ...interface{}) {
+	l.output(1, levelInfo, fmt.Sprintf(format, args...))
+}
+
+func (l Logger) Warning(args ...interface{}) {
+	l.output(1, levelWarning, fmt.Sprint(args...))
+}
+
+func (l Logger) Warningf(format string, args ...interface{}) {
+	l.output(1, levelWarning, fmt.Sprintf(format, args...))
+}
+
+func (l Logger) Error(args ...interface{}) {
+	l.output(1, levelError, fmt.Sprint(args...))
+}
+
+func (l Logger) Errorf(format string, args ...interface{}) {
+	l.output(1, levelError, fmt.Sprintf(format, args...))
+}
+
+// Verbose writes info logs only if the glog verbosity is high enough, like
+// glog.Verbose.
+type Verbose struct {
+	l       Logger
+	enabled bool
+}
+
+// V returns a Verbose which only logs if the glog verbosity is at least level.
+func (l Logger) V(level glog.Level) Verbose {
+	return Verbose{l: l, enabled: bool(glog.V(level))}
+}
+
+func (v Verbose) Info(args ...interface{}) {
+	if v.enabled {
+		v.l.output(1, levelInfo, fmt.Sprint(args...))
+	}
+}
+
+func (v Verbose) Infof(format string, args ...interface{}) {
+	if v.enabled {
+		v.l.output(1, levelInfo, fmt.Sprintf(format, args...))
+	}
+}
+
+// Package level functions log without fields.
+
+func Info(args ...interface{}) {
+	std.output(1, levelInfo, fmt.Sprint(args...))
+}
+
+func Infof(format string, args ...interface{}) {
+	std.output(1, levelInfo, fmt.Sprintf(format, args...))
+}
+
+func Warning(args ...interface{}) {
+	std.output(1, levelWarning, fmt.Sprint(args...))
+}
+
+func Warningf(format string, args ...interface{}) {
+	std.output(1, levelWarning, fmt.Sprintf(format, args...))
+}
+
+func Error(args ...interface{}) {
+	std.output(1, levelError, fmt.Sprint(args...))
+}
+
+func Errorf(format string, args ...interface{}) {
+	std.output(1, levelError, fmt.Sprintf(format, args...))
+}
+
+func V(level glog.Level) Verbose {
+	return Verbose{l: std, enabled: bool(glog.V(level))}
+}
+
+// output writes a log line. depth is the number of stack frames between the
+// caller of the logging function and output, so glog reports the right file
+// and line.
+func (l Logger) output(depth int, level, msg string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !jsonFormat {
+		switch level {
+		case levelWarning:
+			glog.WarningDepth(depth+1, msg)
+		case levelError:
+			glog.ErrorDepth(depth+1, msg)
+		default:
+			glog.InfoDepth(depth+1, msg)
+		}
+		return
+	}
+
+	line := make(map[string]interface{}, len(l.fields)+3)
+	for k, v := range l.fields {
+		line[k] = v
+	}
+	line["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	line["level"] = level
+	line["msg"] = msg
+
+	b, err := json.Marshal(line)
+	if err != nil {
+		b, _ = json.Marshal(map[string]interface{}{
+			"time":  line["time"],
+			"level": levelError,
+			"msg":   fmt.Sprintf("Failed to encode log line %q: %v", msg, err),
+		})
+	}
+	out.Write(append(b, '\n'))
+}
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	out = &buf
+	defer func() {
+		out = os.Stderr
+		SetFormat(FormatText)
+	}()
+
+	if err := SetFormat(FormatJSON); err != nil {
+		t.Fatalf("unexpected error setting format: %v", err)
+	}
+
+	With("node", "node-1").With("phase", "draining").Warningf("Failed to drain node %q", "node-1")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("log line is not valid JSON: %v: %q", err, buf.String())
+	}
+
+	expected := map[string]string{
+		"level": levelWarning,
+		"msg":   `Failed to drain node "node-1"`,
+		"node":  "node-1",
+		"phase": "draining",
+	}
+	for k, v := range expected {
+		if line[k] != v {
+			t.Errorf("expected %q to be %q, got %v", k, v, line[k])
+		}
+	}
+	if _, ok := line["time"]; !ok {
+		t.Errorf("expected log line to have a time")
+	}
+}
+
+func TestWithDoesNotModifyLogger(t *testing.T) {
+	l := With("node", "node-1")
+	l.With("node", "node-2")
+
+	if l.fields["node"] != "node-1" {
+		t.Errorf("expected node to be %q, got %v", "node-1", l.fields["node"])
+	}
+}
+
+func TestSetFormatUnknown(t *testing.T) {
+	if err := SetFormat("xml"); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
@@ -0,0 +1,82 @@
+// Package notifier sends notifications about node reboots to external
+// services, such as a Slack incoming webhook.
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultTimeout is the time a notification is given to be delivered.
+const defaultTimeout = 10 * time.Second
+
+// Notification describes something that happened to a node.
+type Notification struct {
+	// identifier of the cluster the node belongs to
+	Cluster string `json:"cluster,omitempty"`
+	Node    string `json:"node"`
+	// reason of the corresponding Kubernetes event, e.g. "RebootStarted",
+	// and its type, "Normal" or "Warning"
+	Reason  string    `json:"reason"`
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Text returns a human readable summary of the notification.
+func (n Notification) Text() string {
+	if n.Cluster == "" {
+		return fmt.Sprintf("%s: node %s: %s", n.Reason, n.Node, n.Message)
+	}
+	return fmt.Sprintf("%s: node %s in cluster %s: %s", n.Reason, n.Node, n.Cluster, n.Message)
+}
+
+// Notifier delivers notifications.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// Webhook is a Notifier which posts notifications as JSON to a URL. Besides
+// the fields of the notification, the payload contains its summary as "text",
+// so it can be posted to a Slack incoming webhook directly.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhook returns a Webhook posting to the given URL.
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		URL:    url,
+		Client: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// webhookPayload is the JSON payload posted by a Webhook.
+type webhookPayload struct {
+	Notification
+	Text string `json:"text"`
+}
+
+// Notify posts the notification to the URL of the webhook. A response with a
+// status other than 2xx is an error.
+func (w *Webhook) Notify(n Notification) error {
+	body, err := json.Marshal(webhookPayload{Notification: n, Text: n.Text()})
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %v", err)
+	}
+
+	resp, err := w.Client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post notification: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package notifier
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotify(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("expected content type application/json, got %q", ct)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	n := Notification{
+		Cluster: "prod",
+		Node:    "node-1",
+		Reason:  "RebootFailed",
+		Type:    "Warning",
+		Message: "Timeout waiting for node to complete its reboot",
+		Time:    time.Date(2017, 8, 1, 21, 1, 47, 0, time.UTC),
+	}
+	if err := NewWebhook(server.URL).Notify(n); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"cluster": "prod",
+		"node":    "node-1",
+		"reason":  "RebootFailed",
+		"type":    "Warning",
+		"message": "Timeout waiting for node to complete its reboot",
+		"time":    "2017-08-01T21:01:47Z",
+		"text":    "RebootFailed: node node-1 in cluster prod: Timeout waiting for node to complete its reboot",
+	}
+	for key, value := range expected {
+		if got[key] != value {
+			t.Errorf("expected %s to be %q, got %v", key, value, got[key])
+		}
+	}
+}
+
+func TestWebhookNotifyErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := NewWebhook(server.URL).Notify(Notification{Node: "node-1"}); err == nil {
+		t.Fatal("expected an error for a 500 response")
+	}
+}
@@ -0,0 +1,134 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// Outcomes of a reboot.
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+
+	// resultAttempts is the number of times the delivery of a result is
+	// attempted before it is dropped.
+	resultAttempts = 5
+	// resultBackoff is the time waited before the first retry of a result,
+	// doubled for each further retry.
+	resultBackoff = time.Second
+)
+
+// Result is the outcome of a reboot of a node.
+type Result struct {
+	// identifier of the cluster the node belongs to
+	Cluster string `json:"cluster,omitempty"`
+	Node    string `json:"node"`
+	// time the node was allowed to reboot, if known, and the time its reboot
+	// completed or was reported as failed
+	Started  *time.Time `json:"started,omitempty"`
+	Finished time.Time  `json:"finished"`
+	// OutcomeSucceeded or OutcomeFailed
+	Outcome string `json:"outcome"`
+	// reason the reboot was needed, if known
+	Reason string `json:"reason,omitempty"`
+}
+
+// ResultQueue posts reboot results as JSON to a URL in the background, in the
+// order they were added. Results are buffered in memory, up to the size of
+// the queue, so adding a result never blocks while the URL is slow or
+// unavailable. Failed deliveries are retried with an exponential backoff,
+// and dropped after resultAttempts attempts.
+type ResultQueue struct {
+	URL     string
+	Client  *http.Client
+	results chan Result
+	backoff time.Duration
+	// called with each result which was dropped, and why
+	OnDrop func(r Result, err error)
+}
+
+// NewResultQueue returns a ResultQueue posting to the given URL, buffering up
+// to size results.
+func NewResultQueue(url string, size int) *ResultQueue {
+	return &ResultQueue{
+		URL:     url,
+		Client:  &http.Client{Timeout: defaultTimeout},
+		results: make(chan Result, size),
+		backoff: resultBackoff,
+		OnDrop:  func(Result, error) {},
+	}
+}
+
+// Add queues the given result for delivery. If the queue is full, the result
+// is dropped and false is returned.
+func (q *ResultQueue) Add(r Result) bool {
+	select {
+	case q.results <- r:
+		return true
+	default:
+		q.OnDrop(r, fmt.Errorf("result queue is full"))
+		return false
+	}
+}
+
+// Size returns the number of results the queue buffers.
+func (q *ResultQueue) Size() int {
+	return cap(q.results)
+}
+
+// Run delivers the queued results until the stop channel is closed.
+func (q *ResultQueue) Run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case r := <-q.results:
+			q.deliver(r, stop)
+		}
+	}
+}
+
+// deliver posts the given result, retrying failed attempts, until it is
+// delivered, it is dropped, or the stop channel is closed.
+func (q *ResultQueue) deliver(r Result, stop <-chan struct{}) {
+	backoff := q.backoff
+	var err error
+	for attempt := 1; attempt <= resultAttempts; attempt++ {
+		if err = q.post(r); err == nil {
+			return
+		}
+		if attempt == resultAttempts {
+			break
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	q.OnDrop(r, err)
+}
+
+// post posts the given result to the URL of the queue. A response with a
+// status other than 2xx is an error.
+func (q *ResultQueue) post(r Result) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %v", err)
+	}
+
+	resp, err := q.Client.Post(q.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post result: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return nil
+}
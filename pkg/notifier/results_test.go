@@ -0,0 +1,66 @@
+package notifier
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResultQueueRetries(t *testing.T) {
+	var attempts int32
+	received := make(chan Result, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var result Result
+		if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+		received <- result
+	}))
+	defer server.Close()
+
+	q := NewResultQueue(server.URL, 1)
+	q.backoff = time.Millisecond
+	stop := make(chan struct{})
+	defer close(stop)
+	go q.Run(stop)
+
+	started := time.Date(2017, 8, 1, 21, 1, 47, 0, time.UTC)
+	if !q.Add(Result{Node: "node-1", Started: &started, Finished: started.Add(time.Minute), Outcome: OutcomeSucceeded}) {
+		t.Fatal("expected the result to be queued")
+	}
+
+	select {
+	case r := <-received:
+		if r.Node != "node-1" || r.Outcome != OutcomeSucceeded || r.Started == nil || !r.Started.Equal(started) {
+			t.Errorf("unexpected result %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("result was not delivered")
+	}
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Errorf("expected 3 attempts, got %d", n)
+	}
+}
+
+func TestResultQueueFull(t *testing.T) {
+	q := NewResultQueue("http://127.0.0.1:0", 1)
+	var dropped []Result
+	q.OnDrop = func(r Result, err error) { dropped = append(dropped, r) }
+
+	if !q.Add(Result{Node: "node-1"}) {
+		t.Fatal("expected the first result to be queued")
+	}
+	if q.Add(Result{Node: "node-2"}) {
+		t.Fatal("expected the second result to be dropped")
+	}
+	if len(dropped) != 1 || dropped[0].Node != "node-2" {
+		t.Errorf("expected node-2 to be dropped, got %+v", dropped)
+	}
+}
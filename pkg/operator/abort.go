@@ -0,0 +1,81 @@
+package operator
+
+import (
+	"fmt"
+
+	v1api "k8s.io/api/core/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+)
+
+// abortReboots aborts the reboots of the nodes annotated with reboot-abort=true
+// which have not started to reboot yet, i.e. which want to reboot, are in
+// their before-reboot checks or have been allowed to reboot but their
+// update-agent has not started the reboot. Their reboot request is reset, as
+// if the update-agent had not requested it, and they are released like after
+// a reboot: uncordoned, untainted and with their before-reboot annotations
+// removed. The reboot is not reported as failed, but with a RebootAborted
+// event. The nodes which are already rebooting are left alone and reported.
+// In both cases the reboot-abort annotation is removed.
+// If there is an error getting the list of nodes or updating any of them, an
+// error is immediately returned.
+func (k *Kontroller) abortReboots() error {
+	nodelist, err := k.listPassNodes()
+	if err != nil {
+		return fmt.Errorf("Failed listing nodes: %v", err)
+	}
+
+	for i := range nodelist.Items {
+		n := &nodelist.Items[i]
+		if n.Annotations[constants.AnnotationRebootAbort] != constants.True {
+			continue
+		}
+
+		aborted := false
+		err := k.updateNode(n.Name, func(node *v1api.Node) {
+			delete(node.Annotations, constants.AnnotationRebootAbort)
+			aborted = abortable(node)
+			if !aborted {
+				return
+			}
+			node.Annotations[constants.AnnotationRebootNeeded] = constants.False
+			node.Labels[constants.LabelRebootNeeded] = constants.False
+			node.Annotations[constants.AnnotationOkToReboot] = constants.False
+			delete(node.Annotations, constants.AnnotationRebootNeededTime)
+			delete(node.Annotations, constants.AnnotationRebootReason)
+			delete(node.Annotations, constants.AnnotationRebootEmergency)
+			delete(node.Annotations, constants.AnnotationOkToRebootTime)
+			delete(node.Annotations, constants.AnnotationRebootPhase)
+			delete(node.Labels, constants.LabelBeforeReboot)
+			for _, annotation := range k.beforeRebootAnnotations {
+				delete(node.Annotations, annotation)
+			}
+			uncordonIfCordonedByOperator(node)
+			untaintIfTaintedByOperator(node)
+			enableScaleDownIfDisabledByOperator(node)
+			resetApproval(node)
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to abort the reboot of node %q: %v", n.Name, err)
+		}
+
+		if !aborted {
+			nodeLog(n).With("reason", eventReasonRebootAborted).Warningf("Not aborting the reboot of node %q: it is not waiting to reboot", n.Name)
+			k.er.Event(n, v1api.EventTypeWarning, eventReasonRebootAborted,
+				"Reboot not aborted: the node is not waiting to reboot")
+			continue
+		}
+		delete(k.rebootRetries, n.Name)
+		nodeLog(n).With("reason", eventReasonRebootAborted).Infof("Aborted the reboot of node %q", n.Name)
+		k.er.Event(n, v1api.EventTypeNormal, eventReasonRebootAborted, "Reboot aborted")
+	}
+
+	return nil
+}
+
+// abortable returns true if the given node wants to reboot and its
+// update-agent has not started to reboot it yet.
+func abortable(node *v1api.Node) bool {
+	return node.Annotations[constants.AnnotationRebootNeeded] == constants.True &&
+		node.Annotations[constants.AnnotationRebootInProgress] != constants.True
+}
@@ -4,15 +4,14 @@ import (
 	"fmt"
 
 	"github.com/blang/semver"
-	"github.com/golang/glog"
 	"k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
 	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/selection"
 
 	"github.com/coreos/container-linux-update-operator/pkg/constants"
 	"github.com/coreos/container-linux-update-operator/pkg/k8sutil"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
 	"github.com/coreos/container-linux-update-operator/pkg/version"
 )
 
@@ -23,18 +22,6 @@ var (
 		"managed-by": "container-linux-update-operator",
 		"app":        agentDefaultAppName,
 	}
-
-	// Labels nodes where update-agent should be scheduled
-	enableUpdateAgentLabel = map[string]string{
-		constants.LabelUpdateAgentEnabled: constants.True,
-	}
-
-	// Label Requirement matching nodes which lack the update agent label
-	updateAgentLabelMissing = k8sutil.NewRequirementOrDie(
-		constants.LabelUpdateAgentEnabled,
-		selection.DoesNotExist,
-		[]string{},
-	)
 )
 
 // legacyLabeler finds Container Linux nodes lacking the update-agent enabled
@@ -46,24 +33,27 @@ var (
 // the label. Retain this behavior to support upgrades of Tectonic clusters
 // created at 1.6.
 func (k *Kontroller) legacyLabeler() {
-	glog.V(6).Infof("Starting Container Linux node auto-labeler")
+	logging.V(6).Infof("Starting Container Linux node auto-labeler")
 
-	nodelist, err := k.nc.List(v1meta.ListOptions{})
+	nodelist, err := k.listNodes()
 	if err != nil {
-		glog.Infof("Failed listing nodes %v", err)
+		logging.Infof("Failed listing nodes %v", err)
 		return
 	}
 
 	// match nodes that don't have an update-agent label
-	nodesMissingLabel := k8sutil.FilterNodesByRequirement(nodelist.Items, updateAgentLabelMissing)
+	nodesMissingLabel := k8sutil.FilterNodesByRequirement(nodelist.Items, updateAgentLabelMissingReq)
 	// match nodes that identify as Container Linux
 	nodesToLabel := k8sutil.FilterContainerLinuxNodes(nodesMissingLabel)
-	glog.V(6).Infof("Found Container Linux nodes to label: %+v", nodelist.Items)
+	logging.V(6).Infof("Found Container Linux nodes to label: %+v", nodelist.Items)
 
 	for _, node := range nodesToLabel {
-		glog.Infof("Setting label 'agent=true' on %q", node.Name)
-		if err := k8sutil.SetNodeLabels(k.nc, node.Name, enableUpdateAgentLabel); err != nil {
-			glog.Errorf("Failed setting label 'agent=true' on %q", node.Name)
+		logging.Infof("Setting label 'agent=true' on %q", node.Name)
+		err := k.updateNode(node.Name, func(n *v1.Node) {
+			n.Labels[constants.LabelUpdateAgentEnabled] = constants.True
+		})
+		if err != nil {
+			logging.Errorf("Failed setting label 'agent=true' on %q", node.Name)
 		}
 	}
 }
@@ -96,7 +86,7 @@ func (k *Kontroller) runDaemonsetUpdate(agentImageRepo string) error {
 	// There should only be one daemonset since we use a well-known name and
 	// patch it each time rather than creating new ones.
 	if len(agentDaemonsets.Items) > 1 {
-		glog.Errorf("only expected one daemonset managed by operator; found %+v", agentDaemonsets.Items)
+		logging.Errorf("only expected one daemonset managed by operator; found %+v", agentDaemonsets.Items)
 		return fmt.Errorf("only expected one daemonset managed by operator; found %v", len(agentDaemonsets.Items))
 	}
 
@@ -110,7 +100,7 @@ func (k *Kontroller) runDaemonsetUpdate(agentImageRepo string) error {
 		}
 		dsSemver = ver
 	} else {
-		glog.Errorf("managed daemonset did not have a version annotation: %+v", agentDS)
+		logging.Errorf("managed daemonset did not have a version annotation: %+v", agentDS)
 		return fmt.Errorf("managed daemonset did not have a version annotation")
 	}
 
@@ -125,13 +115,13 @@ func (k *Kontroller) runDaemonsetUpdate(agentImageRepo string) error {
 			OrphanDependents: &falseVal, // Cascading delete
 		})
 		if err != nil {
-			glog.Errorf("could not delete old daemonset %+v: %v", agentDS, err)
+			logging.Errorf("could not delete old daemonset %+v: %v", agentDS, err)
 			return err
 		}
 
 		err = k.createAgentDamonset(agentImageRepo)
 		if err != nil {
-			glog.Errorf("could not create new daemonset: %v", err)
+			logging.Errorf("could not create new daemonset: %v", err)
 			return err
 		}
 	}
@@ -213,6 +203,10 @@ func agentDaemonsetSpec(repo string) *v1beta1.DaemonSet {
 										},
 									},
 								},
+								{
+									Name:  "UPDATE_AGENT_ANNOTATION_PREFIX",
+									Value: constants.Prefix,
+								},
 								{
 									Name: "POD_NAMESPACE",
 									ValueFrom: &v1.EnvVarSource{
@@ -0,0 +1,43 @@
+package operator
+
+import (
+	"fmt"
+
+	v1api "k8s.io/api/core/v1"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// defaultAgentPodSelector selects the update-agent pods when no other selector
+// is configured. It matches the pods of the example update-agent DaemonSet and
+// of the DaemonSet managed by the operator.
+var defaultAgentPodSelector = "app=" + agentDefaultAppName
+
+// agentRunning returns true if an update-agent pod, as selected by the
+// configured agent pod selector, is running and ready on the named node.
+func (k *Kontroller) agentRunning(nodeName string) (bool, error) {
+	pods, err := k.kc.CoreV1().Pods(v1api.NamespaceAll).List(v1meta.ListOptions{
+		LabelSelector: k.agentPodSelector.String(),
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("Failed listing update-agent pods on node %q: %v", nodeName, err)
+	}
+
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == v1api.PodRunning && podReady(&pod) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// podReady returns true if the Ready condition of the given pod is True.
+func podReady(pod *v1api.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1api.PodReady {
+			return c.Status == v1api.ConditionTrue
+		}
+	}
+	return false
+}
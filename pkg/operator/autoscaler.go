@@ -0,0 +1,38 @@
+package operator
+
+import (
+	v1api "k8s.io/api/core/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+// annotationScaleDownDisabled is the annotation of the cluster-autoscaler
+// which prevents it from scaling down a node.
+const annotationScaleDownDisabled = "cluster-autoscaler.kubernetes.io/scale-down-disabled"
+
+// disableScaleDown prevents the cluster-autoscaler from scaling down the given
+// node while the update-operator reboots it. A node whose scale-down is
+// disabled by disableScaleDown is annotated, so it is enabled again after the
+// reboot, even if the operator restarted in the meantime. Nodes whose
+// scale-down is already disabled are left alone.
+func disableScaleDown(node *v1api.Node) {
+	if _, ok := node.Annotations[annotationScaleDownDisabled]; ok {
+		return
+	}
+	logging.V(4).Infof("Disabling scale-down of node %q", node.Name)
+	node.Annotations[annotationScaleDownDisabled] = constants.True
+	node.Annotations[constants.AnnotationScaleDownDisabledByOperator] = constants.True
+}
+
+// enableScaleDownIfDisabledByOperator allows the cluster-autoscaler to scale
+// down the given node again if its scale-down was disabled by the
+// update-operator.
+func enableScaleDownIfDisabledByOperator(node *v1api.Node) {
+	if node.Annotations[constants.AnnotationScaleDownDisabledByOperator] != constants.True {
+		return
+	}
+	logging.V(4).Infof("Enabling scale-down of node %q", node.Name)
+	delete(node.Annotations, annotationScaleDownDisabled)
+	delete(node.Annotations, constants.AnnotationScaleDownDisabledByOperator)
+}
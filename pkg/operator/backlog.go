@@ -0,0 +1,48 @@
+package operator
+
+import (
+	"time"
+
+	v1api "k8s.io/api/core/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+const (
+	// defaultRebootBacklogDuration is how long the reboot backlog must
+	// exceed its threshold before it is reported, when no other value is
+	// configured.
+	defaultRebootBacklogDuration = time.Hour
+)
+
+// recordRebootBacklog records the number of nodes wanting to reboot. If it
+// has exceeded the configured backlog threshold for longer than the backlog
+// duration, e.g. because reboots are blocked, a RebootBacklog event is
+// recorded on the leader election lock, once until the backlog shrinks back
+// to the threshold, so transient spikes are not reported.
+func (k *Kontroller) recordRebootBacklog(wanting int) {
+	nodesWantingReboot.Set(float64(wanting))
+	if k.rebootBacklogThreshold == 0 {
+		return
+	}
+
+	if wanting <= k.rebootBacklogThreshold {
+		if k.backlogReported {
+			logging.Infof("Reboot backlog of %d nodes is back within threshold %d", wanting, k.rebootBacklogThreshold)
+		}
+		k.backlogSince = time.Time{}
+		k.backlogReported = false
+		return
+	}
+
+	if k.backlogSince.IsZero() {
+		k.backlogSince = time.Now()
+	}
+	if k.backlogReported || time.Since(k.backlogSince) < k.rebootBacklogDuration {
+		return
+	}
+	logging.With("reason", eventReasonRebootBacklog).Warningf("%d nodes want to reboot, more than %d for longer than %v", wanting, k.rebootBacklogThreshold, k.rebootBacklogDuration)
+	k.er.Eventf(k.leaderElectionLockReference(), v1api.EventTypeWarning, eventReasonRebootBacklog,
+		"%d nodes want to reboot, more than %d for longer than %v", wanting, k.rebootBacklogThreshold, k.rebootBacklogDuration)
+	k.backlogReported = true
+}
@@ -0,0 +1,94 @@
+package operator
+
+import (
+	"sort"
+
+	v1api "k8s.io/api/core/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+// rebootBatchNodes returns the nodes wanting to reboot which belong to the
+// current reboot batch, i.e. which have the same value of the configured batch
+// label, or all of them if no batch label is configured. Nodes without the
+// label form a batch of their own.
+//
+// A batch is finished once none of its nodes want to reboot or are rebooting,
+// and only then is the next batch started, with the batch of the first node
+// wanting to reboot in reboot order. The nodes wanting to reboot are all
+// listed nodes requesting a reboot, not only the ones which may reboot in the
+// current pass, e.g. during a reboot cooldown, except for the nodes with the
+// off reboot strategy, which are never rebooted. If the operator restarted in the middle
+// of a batch, the batch of the rebooting nodes is resumed. A BatchStarted and
+// a BatchFinished event are recorded on the leader election lock for each
+// batch.
+func (k *Kontroller) rebootBatchNodes(rebootableNodes, wantingNodes, rebootingNodes []v1api.Node) []v1api.Node {
+	if k.batchLabel == "" {
+		return rebootableNodes
+	}
+
+	wanting := make(map[string]int)
+	for _, n := range wantingNodes {
+		if rebootStrategy(&n) != constants.RebootStrategyOff {
+			wanting[n.Labels[k.batchLabel]]++
+		}
+	}
+	rebooting := make(map[string]bool)
+	for _, n := range rebootingNodes {
+		rebooting[n.Labels[k.batchLabel]] = true
+	}
+
+	if k.batchActive && wanting[k.batch] == 0 && !rebooting[k.batch] {
+		logging.Infof("Reboot batch %s=%q finished", k.batchLabel, k.batch)
+		k.er.Eventf(k.leaderElectionLockReference(), v1api.EventTypeNormal, eventReasonBatchFinished,
+			"Reboot batch %s=%q finished", k.batchLabel, k.batch)
+		k.batchActive = false
+	}
+
+	if !k.batchActive {
+		switch {
+		case len(rebootingNodes) > 0:
+			// resume the batch of the nodes which are already rebooting,
+			// e.g. after a restart
+			names := make([]string, 0, len(rebootingNodes))
+			batches := make(map[string]string)
+			for _, n := range rebootingNodes {
+				names = append(names, n.Name)
+				batches[n.Name] = n.Labels[k.batchLabel]
+			}
+			sort.Strings(names)
+			k.batch = batches[names[0]]
+		case len(rebootableNodes) > 0:
+			k.batch = rebootableNodes[0].Labels[k.batchLabel]
+		default:
+			return nil
+		}
+		k.batchActive = true
+		logging.Infof("Starting reboot batch %s=%q: %d nodes want to reboot", k.batchLabel, k.batch, wanting[k.batch])
+		k.er.Eventf(k.leaderElectionLockReference(), v1api.EventTypeNormal, eventReasonBatchStarted,
+			"Reboot batch %s=%q started: %d nodes want to reboot", k.batchLabel, k.batch, wanting[k.batch])
+	}
+
+	var batchNodes []v1api.Node
+	for _, n := range rebootableNodes {
+		if n.Labels[k.batchLabel] == k.batch {
+			batchNodes = append(batchNodes, n)
+		}
+	}
+	if len(batchNodes) < len(rebootableNodes) {
+		logging.V(4).Infof("Not rebooting %d nodes outside of reboot batch %s=%q yet", len(rebootableNodes)-len(batchNodes), k.batchLabel, k.batch)
+	}
+	return batchNodes
+}
+
+// leaderElectionLockReference returns a reference to the leader election lock,
+// to record events about the operator rather than a node on.
+func (k *Kontroller) leaderElectionLockReference() *v1api.ObjectReference {
+	return &v1api.ObjectReference{
+		Kind:       "ConfigMap",
+		APIVersion: "v1",
+		Namespace:  k.leaderElectionNamespace,
+		Name:       k.leaderElectionName,
+	}
+}
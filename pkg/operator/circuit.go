@@ -0,0 +1,80 @@
+package operator
+
+import (
+	"fmt"
+
+	v1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+	"github.com/coreos/container-linux-update-operator/pkg/k8sutil"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+// annotationResetRebootFailures may be set to "true" on the pause ConfigMap of
+// the operator, following the label and annotation prefix, to allow reboots
+// again after they were halted by too many consecutive reboot failures. The
+// operator removes it once the failures are reset.
+const annotationResetRebootFailures = "reset-reboot-failures"
+
+// rebootsHalted returns true if the maximum number of consecutive reboot
+// failures is configured and has been reached, so no more nodes may reboot.
+func (k *Kontroller) rebootsHalted() bool {
+	return k.maxRebootFailures > 0 && k.consecutiveRebootFailures >= k.maxRebootFailures
+}
+
+// countRebootFailure counts a failed reboot of the given node towards the
+// consecutive reboot failures, and halts reboots once the maximum is reached.
+func (k *Kontroller) countRebootFailure(n *v1api.Node) {
+	k.consecutiveRebootFailures++
+	if k.maxRebootFailures == 0 || k.consecutiveRebootFailures != k.maxRebootFailures {
+		return
+	}
+
+	rebootsHaltedGauge.Set(1)
+	nodeLog(n).With("reason", eventReasonRebootsHalted).Errorf("%d consecutive reboots failed, the last one of node %q: halting reboots until annotation %q is set to true on ConfigMap %s/%s or the operator is restarted",
+		k.consecutiveRebootFailures, n.Name, constants.Prefix+annotationResetRebootFailures, k.namespace, pauseConfigMapName)
+	k.er.Eventf(n, v1api.EventTypeWarning, eventReasonRebootsHalted,
+		"Reboots halted: %d consecutive reboots failed, the last one of this node", k.consecutiveRebootFailures)
+}
+
+// resetRebootFailures resets the consecutive reboot failures if the reset
+// annotation is set on the pause ConfigMap, and removes the annotation.
+// It returns true if the failures were reset.
+func (k *Kontroller) resetRebootFailures() (bool, error) {
+	cms := k.kc.CoreV1().ConfigMaps(k.namespace)
+	key := constants.Prefix + annotationResetRebootFailures
+
+	reset := false
+	err := k8sutil.RetryOnConflict(k8sutil.DefaultBackoff, func() error {
+		cm, err := cms.Get(pauseConfigMapName, v1meta.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Annotations[key] != constants.True {
+			return nil
+		}
+		reset = true
+		if k.dryRun {
+			logging.Infof("Dry run: would remove annotation %q from ConfigMap %s/%s", key, k.namespace, pauseConfigMapName)
+			return nil
+		}
+		delete(cm.Annotations, key)
+		_, err = cms.Update(cm)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("Failed to check annotation %q of ConfigMap %s/%s: %v", key, k.namespace, pauseConfigMapName, err)
+	}
+
+	if reset {
+		logging.Infof("Resetting %d consecutive reboot failures as requested by annotation %q, allowing reboots again", k.consecutiveRebootFailures, key)
+		k.consecutiveRebootFailures = 0
+		rebootsHaltedGauge.Set(0)
+	}
+	return reset, nil
+}
@@ -0,0 +1,38 @@
+package operator
+
+import (
+	"sync"
+
+	v1api "k8s.io/api/core/v1"
+)
+
+// cleanupNodes runs f for each of the given nodes, for up to the configured
+// cleanup concurrency of them at once, and returns the error f returned for
+// each node, by index. f must only update the given node, and must not change
+// the state of the Kontroller.
+func (k *Kontroller) cleanupNodes(nodes []v1api.Node, f func(n *v1api.Node) error) []error {
+	errs := make([]error, len(nodes))
+	sem := make(chan struct{}, k.cleanupConcurrency)
+	var wg sync.WaitGroup
+	for i := range nodes {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = f(&nodes[i])
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// firstError returns the first non-nil error of the given errors, or nil.
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
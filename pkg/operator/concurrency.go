@@ -0,0 +1,65 @@
+package operator
+
+import (
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+// concurrencyConfigMapKey is the key of the pause ConfigMap which may be set
+// to the maximum number of rebooting nodes, overriding the flags and the
+// RebootPolicy without restarting the operator.
+const concurrencyConfigMapKey = "max-rebooting-nodes"
+
+// loadMaxRebootingNodesOverride reads the maximum number of rebooting nodes
+// set in the pause ConfigMap, re-read on every reconciliation so it can be
+// changed during a maintenance window. The maximum configured by the flags
+// or the RebootPolicy applies if the ConfigMap or its key does not exist, or
+// if the value is invalid. If the ConfigMap cannot be read, the maximum in
+// effect is kept.
+func (k *Kontroller) loadMaxRebootingNodesOverride() {
+	var override int
+	cm, err := k.kc.CoreV1().ConfigMaps(k.namespace).Get(pauseConfigMapName, v1meta.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		logging.Errorf("Failed to get ConfigMap %s/%s: %v", k.namespace, pauseConfigMapName, err)
+		return
+	default:
+		override, err = parseMaxRebootingNodesOverride(cm.Data[concurrencyConfigMapKey])
+		if err != nil {
+			logging.Errorf("Ignoring %q in ConfigMap %s/%s: %v", concurrencyConfigMapKey, k.namespace, pauseConfigMapName, err)
+		}
+	}
+
+	if override == k.maxRebootingNodesOverride {
+		return
+	}
+	if override > 0 {
+		logging.Infof("Maximum number of rebooting nodes set to %d by %q in ConfigMap %s/%s", override, concurrencyConfigMapKey, k.namespace, pauseConfigMapName)
+	} else {
+		logging.Infof("Maximum number of rebooting nodes no longer set by ConfigMap %s/%s, using the configured maximum", k.namespace, pauseConfigMapName)
+	}
+	k.maxRebootingNodesOverride = override
+}
+
+// parseMaxRebootingNodesOverride parses the maximum number of rebooting nodes
+// set in the pause ConfigMap, raised to 1 if lower, or returns 0 if it is
+// empty.
+func parseMaxRebootingNodesOverride(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	max, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("must be an integer, got %q", s)
+	}
+	if max < 1 {
+		max = 1
+	}
+	return max, nil
+}
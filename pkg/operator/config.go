@@ -0,0 +1,233 @@
+package operator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+// effectiveConfig is the configuration of the update-operator after defaults
+// have been applied, as served by the config endpoint. Durations are
+// formatted like the flags, e.g. "1h30m0s". The settings overridden by a
+// RebootPolicy are the ones configured by the flags. URLs are reduced to
+// their scheme and host, as their credentials, path or query may be secret.
+type effectiveConfig struct {
+	Namespace               string   `json:"namespace"`
+	OperatorNode            string   `json:"operatorNode,omitempty"`
+	LeaderElectionName      string   `json:"leaderElectionName"`
+	LeaderElectionNamespace string   `json:"leaderElectionNamespace"`
+	NodeSelector            string   `json:"nodeSelector"`
+	Nodes                   []string `json:"nodes,omitempty"`
+	BeforeRebootAnnotations []string `json:"beforeRebootAnnotations"`
+	AfterRebootAnnotations  []string `json:"afterRebootAnnotations"`
+	AfterRebootPodSelector  string   `json:"afterRebootPodSelector,omitempty"`
+	PostRebootDelay         string   `json:"postRebootDelay"`
+
+	// reboot window, always open if empty
+	RebootWindowStart    string   `json:"rebootWindowStart,omitempty"`
+	RebootWindowLength   string   `json:"rebootWindowLength,omitempty"`
+	RebootWindowTimezone string   `json:"rebootWindowTimezone"`
+	RebootFreezes        []string `json:"rebootFreezes,omitempty"`
+	RebootPolicy         string   `json:"rebootPolicy,omitempty"`
+
+	// only one of them is set
+	MaxRebootingNodes int    `json:"maxRebootingNodes,omitempty"`
+	MaxUnavailable    string `json:"maxUnavailable,omitempty"`
+
+	RebootNotReady           bool   `json:"rebootNotReady"`
+	RebootOSVersion          string `json:"rebootOSVersion,omitempty"`
+	RebootOrder              string `json:"rebootOrder"`
+	SeparateControlPlane     bool   `json:"separateControlPlane"`
+	BatchLabel               string `json:"batchLabel,omitempty"`
+	EtcdNodeSelector         string `json:"etcdNodeSelector,omitempty"`
+	EtcdMaxConcurrency       int    `json:"etcdMaxConcurrency"`
+	MaxRebootingNodesPerZone int    `json:"maxRebootingNodesPerZone"`
+	MinReadyNodes            int    `json:"minReadyNodes"`
+	MaxRebootCandidates      int    `json:"maxRebootCandidates"`
+	CleanupConcurrency       int    `json:"cleanupConcurrency"`
+	RebootStrategy           string `json:"rebootStrategy"`
+	UpgradeAnnotation        string `json:"upgradeAnnotation,omitempty"`
+	UpgradeConfigMap         string `json:"upgradeConfigMap,omitempty"`
+
+	RebootReasonPolicies      []string `json:"rebootReasonPolicies,omitempty"`
+	RebootReasonDefaultPolicy string   `json:"rebootReasonDefaultPolicy"`
+
+	RebootPredicates            []string `json:"rebootPredicates,omitempty"`
+	RebootPredicateTimeout      string   `json:"rebootPredicateTimeout"`
+	BeforeRebootHook            string   `json:"beforeRebootHook,omitempty"`
+	AfterRebootHook             string   `json:"afterRebootHook,omitempty"`
+	AfterRebootHookKeepCordoned bool     `json:"afterRebootHookKeepCordoned"`
+	RebootHookTimeout           string   `json:"rebootHookTimeout"`
+
+	DrainBeforeReboot      bool   `json:"drainBeforeReboot"`
+	DrainMode              string `json:"drainMode"`
+	DrainGracePeriod       string `json:"drainGracePeriod"`
+	DrainTimeout           string `json:"drainTimeout"`
+	DrainForce             bool   `json:"drainForce"`
+	ProtectedPriorityClass string `json:"protectedPriorityClass,omitempty"`
+	RebootTaint            string `json:"rebootTaint,omitempty"`
+
+	RebootTimeout     string `json:"rebootTimeout"`
+	RebootMaxRetries  int    `json:"rebootMaxRetries"`
+	ForceRebootAfter  string `json:"forceRebootAfter"`
+	RebootRequestTTL  string `json:"rebootRequestTTL"`
+	AgentPodSelector  string `json:"agentPodSelector"`
+	AgentMissingReset bool   `json:"agentMissingReset"`
+	RebootCooldown    string `json:"rebootCooldown"`
+	FlappingReboots   int    `json:"flappingReboots"`
+	FlappingWindow    string `json:"flappingWindow"`
+	MaxRebootFailures int    `json:"maxRebootFailures"`
+
+	ResultWebhookURL string `json:"resultWebhookURL,omitempty"`
+	ResultQueueSize  int    `json:"resultQueueSize,omitempty"`
+
+	RebootBacklogThreshold int    `json:"rebootBacklogThreshold"`
+	RebootBacklogDuration  string `json:"rebootBacklogDuration"`
+
+	DryRun          bool    `json:"dryRun"`
+	DisableCleanup  bool    `json:"disableCleanup"`
+	ReconcileQPS    float32 `json:"reconcileQPS"`
+	ReconcileBurst  int     `json:"reconcileBurst"`
+	ReconcileJitter float64 `json:"reconcileJitter"`
+}
+
+// newEffectiveConfig returns the effective configuration of the Kontroller,
+// as populated by New from the given configuration. The values which the
+// Kontroller only keeps in parsed form are taken from the configuration.
+func (k *Kontroller) newEffectiveConfig(config Config) *effectiveConfig {
+	c := &effectiveConfig{
+		Namespace:                   k.namespace,
+		OperatorNode:                k.operatorNode,
+		LeaderElectionName:          k.leaderElectionName,
+		LeaderElectionNamespace:     k.leaderElectionNamespace,
+		NodeSelector:                selectorString(k.nodeSelector),
+		BeforeRebootAnnotations:     k.beforeRebootAnnotations,
+		AfterRebootAnnotations:      k.afterRebootAnnotations,
+		AfterRebootPodSelector:      selectorString(k.afterRebootPodSelector),
+		PostRebootDelay:             k.postRebootDelay.String(),
+		RebootWindowTimezone:        k.rebootWindowLocation.String(),
+		RebootFreezes:               config.RebootFreezes,
+		RebootPolicy:                k.rebootPolicyName,
+		RebootNotReady:              k.rebootNotReady,
+		RebootOSVersion:             k.rebootOSVersion,
+		RebootOrder:                 config.RebootOrder,
+		SeparateControlPlane:        k.separateControlPlane,
+		BatchLabel:                  k.batchLabel,
+		EtcdNodeSelector:            selectorString(k.etcdNodeSelector),
+		EtcdMaxConcurrency:          k.etcdMaxConcurrency,
+		MaxRebootingNodesPerZone:    k.maxRebootingNodesPerZone,
+		MinReadyNodes:               k.minReadyNodes,
+		MaxRebootCandidates:         k.maxRebootCandidates,
+		CleanupConcurrency:          k.cleanupConcurrency,
+		RebootStrategy:              k.rebootStrategy,
+		UpgradeAnnotation:           k.upgradeAnnotation,
+		UpgradeConfigMap:            config.UpgradeConfigMap,
+		RebootReasonDefaultPolicy:   k.defaultReasonPolicy,
+		RebootPredicateTimeout:      k.rebootPredicateTimeout.String(),
+		BeforeRebootHook:            redactHook(k.beforeRebootHook),
+		AfterRebootHook:             redactHook(k.afterRebootHook),
+		AfterRebootHookKeepCordoned: k.afterRebootHookKeepCordoned,
+		RebootHookTimeout:           k.rebootHookTimeout.String(),
+		DrainBeforeReboot:           k.drainBeforeReboot,
+		DrainMode:                   k.drainMode,
+		DrainGracePeriod:            k.drainGracePeriod.String(),
+		DrainTimeout:                k.drainTimeout.String(),
+		DrainForce:                  k.drainForce,
+		ProtectedPriorityClass:      k.protectedPriorityClass,
+		RebootTimeout:               k.rebootTimeout.String(),
+		RebootMaxRetries:            k.rebootMaxRetries,
+		ForceRebootAfter:            k.forceRebootAfter.String(),
+		RebootRequestTTL:            k.rebootRequestTTL.String(),
+		AgentPodSelector:            selectorString(k.agentPodSelector),
+		AgentMissingReset:           k.agentMissingReset,
+		RebootCooldown:              k.rebootCooldown.String(),
+		FlappingReboots:             k.flappingReboots,
+		FlappingWindow:              k.flappingWindow.String(),
+		MaxRebootFailures:           k.maxRebootFailures,
+		RebootBacklogThreshold:      k.rebootBacklogThreshold,
+		RebootBacklogDuration:       k.rebootBacklogDuration.String(),
+		DryRun:                      k.dryRun,
+		DisableCleanup:              k.disableCleanup,
+		ReconcileQPS:                config.ReconcileQPS,
+		ReconcileBurst:              config.ReconcileBurst,
+		ReconcileJitter:             k.reconcileJitter,
+	}
+	if c.RebootOrder == "" {
+		c.RebootOrder = rebootOrderOldestFirst
+	}
+	if c.ReconcileQPS == 0 {
+		c.ReconcileQPS = defaultReconcileQPS
+	}
+	if c.ReconcileBurst == 0 {
+		c.ReconcileBurst = defaultReconcileBurst
+	}
+	for name := range k.nodeNames {
+		c.Nodes = append(c.Nodes, name)
+	}
+	sort.Strings(c.Nodes)
+	if k.rebootWindow != nil {
+		c.RebootWindowStart = config.RebootWindowStart
+		c.RebootWindowLength = config.RebootWindowLength
+	}
+	if k.maxUnavailable != nil {
+		c.MaxUnavailable = k.maxUnavailable.String()
+	} else {
+		c.MaxRebootingNodes = k.maxRebootingNodes
+	}
+	for _, hook := range k.rebootPredicateHooks {
+		c.RebootPredicates = append(c.RebootPredicates, redactHook(hook))
+	}
+	for _, p := range k.reasonPolicies {
+		c.RebootReasonPolicies = append(c.RebootReasonPolicies, p.prefix+"="+p.policy)
+	}
+	if k.rebootTaint != nil {
+		c.RebootTaint = k.rebootTaint.ToString()
+	}
+	if k.results != nil {
+		c.ResultWebhookURL = redactURL(k.results.URL)
+		c.ResultQueueSize = k.results.Size()
+	}
+	return c
+}
+
+// selectorString returns the given label selector as a string, empty if nil.
+func selectorString(s labels.Selector) string {
+	if s == nil {
+		return ""
+	}
+	return s.String()
+}
+
+// redactHook returns the given hook with its URL redacted if it is an http
+// or https URL, or the given hook if it is a command.
+func redactHook(hook string) string {
+	if strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://") {
+		return redactURL(hook)
+	}
+	return hook
+}
+
+// redactURL returns the scheme and host of the given URL, leaving out its
+// user info, path, query and fragment. Empty if the URL is empty or invalid.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+}
+
+// configHandler serves the effective configuration of the update-operator as
+// JSON.
+func (k *Kontroller) configHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(k.config); err != nil {
+		logging.Errorf("Failed to write config: %v", err)
+	}
+}
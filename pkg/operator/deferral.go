@@ -0,0 +1,72 @@
+package operator
+
+import (
+	"fmt"
+
+	v1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// deferNode records why the given node wanting to reboot is not chosen to
+// reboot in the current pass, for the status endpoint. Only the first reason
+// found for a node in a pass is kept.
+func (k *Kontroller) deferNode(n *v1api.Node, format string, args ...interface{}) {
+	if _, ok := k.deferredReasons[n.Name]; !ok {
+		k.deferredReasons[n.Name] = fmt.Sprintf(format, args...)
+	}
+}
+
+// deferNodes records why the given nodes are not chosen to reboot in the
+// current pass, unless another reason was recorded for them already.
+func (k *Kontroller) deferNodes(nodes []v1api.Node, format string, args ...interface{}) {
+	for i := range nodes {
+		k.deferNode(&nodes[i], format, args...)
+	}
+}
+
+// deferAll records why no node is chosen to reboot in the current pass, for
+// the nodes without a reason of their own.
+func (k *Kontroller) deferAll(format string, args ...interface{}) {
+	k.deferredReason = fmt.Sprintf(format, args...)
+}
+
+// chooseNode records that the given node is chosen to reboot in the current
+// pass, so it is not reported as deferred, and its next deferral is reported
+// again.
+func (k *Kontroller) chooseNode(n *v1api.Node) {
+	k.deferredReasons[n.Name] = ""
+	delete(k.deferralsReported, n.Name)
+}
+
+// forgetDeferrals forgets the reported deferrals of the given nodes which no
+// longer want to reboot, so their deferrals are reported again once they
+// request their next reboot.
+func (k *Kontroller) forgetDeferrals(nodes []v1api.Node) {
+	for i := range nodes {
+		if !wantsRebootSelector.Matches(fields.Set(nodes[i].Annotations)) {
+			delete(k.deferralsReported, nodes[i].Name)
+		}
+	}
+}
+
+// reportDeferral records a RebootDeferred event of the given type on the
+// given node, unless its last reported deferral had the same reason, e.g. the
+// name of the failed predicate, so a node deferred for the same reason on
+// every pass is only reported once.
+func (k *Kontroller) reportDeferral(n *v1api.Node, reason, eventType, format string, args ...interface{}) {
+	if k.deferralsReported[n.Name] == reason {
+		return
+	}
+	k.deferralsReported[n.Name] = reason
+	k.er.Eventf(n, eventType, eventReasonRebootDeferred, format, args...)
+}
+
+// deferredReasonOf returns why the named node wanting to reboot was not
+// chosen to reboot in the current pass, or an empty reason if it was or no
+// reason is known.
+func (k *Kontroller) deferredReasonOf(name string) string {
+	if reason, ok := k.deferredReasons[name]; ok {
+		return reason
+	}
+	return k.deferredReason
+}
@@ -0,0 +1,90 @@
+package operator
+
+import (
+	"sort"
+
+	v1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+// forgetDeletedNodes removes the state tracked for the nodes which are no
+// longer among the given nodes, because they have been deleted, e.g. scaled
+// down or replaced, or are no longer managed, e.g. excluded or outside of the
+// node selector. Deleted nodes which were chosen to reboot and never
+// completed their reboot are reported with a NodeDeleted event on the leader
+// election lock, as their reboot did not fail: there is nothing left to
+// reboot. Each node is only looked up once, as its state is forgotten either
+// way, unless the lookup failed.
+func (k *Kontroller) forgetDeletedNodes(nodes []v1api.Node) {
+	listed := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		listed[n.Name] = true
+	}
+
+	tracked := make(map[string]bool)
+	for name := range k.rebootAttempts {
+		tracked[name] = true
+	}
+	for name := range k.failedReboots {
+		tracked[name] = true
+	}
+	for name := range k.rebootFailureEvents {
+		tracked[name] = true
+	}
+	for name := range k.rebootRetries {
+		tracked[name] = true
+	}
+	for name := range k.expiredRebootRequests {
+		tracked[name] = true
+	}
+	for name := range k.awaitingApprovalReported {
+		tracked[name] = true
+	}
+	for name := range k.deferralsReported {
+		tracked[name] = true
+	}
+	for name := range k.afterRebootSettle {
+		tracked[name] = true
+	}
+
+	var forgotten []string
+	deleted := make(map[string]bool)
+	for name := range tracked {
+		if listed[name] {
+			continue
+		}
+		_, err := k.nc.Get(name, v1meta.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			logging.V(4).Infof("Failed to check whether node %q was deleted: %v", name, err)
+			continue
+		}
+		forgotten = append(forgotten, name)
+		deleted[name] = err != nil
+	}
+	sort.Strings(forgotten)
+
+	for _, name := range forgotten {
+		_, attempted := k.rebootAttempts[name]
+		switch {
+		case deleted[name] && attempted:
+			logging.With("node", name).With("reason", eventReasonNodeDeleted).Infof("Node %q was deleted before completing its reboot", name)
+			k.er.Eventf(k.leaderElectionLockReference(), v1api.EventTypeNormal, eventReasonNodeDeleted,
+				"Node %q was deleted before completing its reboot", name)
+		case deleted[name]:
+			logging.V(4).Infof("Forgetting deleted node %q", name)
+		default:
+			logging.V(4).Infof("Forgetting node %q: it is no longer managed", name)
+		}
+		delete(k.rebootAttempts, name)
+		delete(k.failedReboots, name)
+		delete(k.rebootFailureEvents, name)
+		delete(k.rebootRetries, name)
+		delete(k.expiredRebootRequests, name)
+		delete(k.awaitingApprovalReported, name)
+		delete(k.deferralsReported, name)
+		delete(k.afterRebootSettle, name)
+	}
+}
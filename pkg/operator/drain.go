@@ -0,0 +1,315 @@
+package operator
+
+import (
+	"fmt"
+	"time"
+
+	v1api "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+	"github.com/coreos/container-linux-update-operator/pkg/drain"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+const (
+	// defaultDrainGracePeriod is the period of time given to an evicted pod
+	// to terminate when no other value is configured. It matches the default
+	// grace period of the update-agent.
+	defaultDrainGracePeriod = 10 * time.Minute
+
+	// drainPollInterval is how often evicted pods are checked for deletion.
+	drainPollInterval = 5 * time.Second
+
+	// Drain modes. In the cordon-only mode, nodes are cordoned, or tainted,
+	// before they reboot, but their pods are not evicted.
+	drainModeDrain      = "drain"
+	drainModeCordonOnly = "cordon-only"
+)
+
+// drainNode cordons the given node, or adds the reboot taint to it if one is
+// configured, and evicts its pods through the eviction API, so
+// PodDisruptionBudgets are respected. Mirror pods and pods managed by
+// an existing DaemonSet are skipped, as `kubectl drain` does. A node cordoned
+// by drainNode is annotated, so it is uncordoned after its reboot.
+// Nodes running a pod protected by the protected PriorityClass, which may
+// have been scheduled since the node was chosen to reboot, are not drained and
+// an error is returned, so critical pods are never evicted.
+// Evictions refused because of a PodDisruptionBudget are retried for up to the
+// drain timeout. A PodEvictionFailed event is recorded for each pod which
+// could not be evicted in time, which is then deleted if drain force is
+// configured. Otherwise an error is returned and the node should not be
+// rebooted yet.
+// It waits up to the drain grace period for evicted pods to be deleted. An
+// error is also returned if the stop channel is closed while waiting.
+// In the cordon-only drain mode, the node is only cordoned or tainted, and no
+// pod is evicted.
+func (k *Kontroller) drainNode(n *v1api.Node, stop <-chan struct{}) error {
+	protected, err := k.protectedPod(n)
+	if err != nil {
+		return err
+	}
+	if protected != nil {
+		k.er.Eventf(n, v1api.EventTypeWarning, eventReasonDrainBlocked,
+			"Drain blocked: pod %s/%s has at least the priority of protected priority class %q", protected.Namespace, protected.Name, k.protectedPriorityClass)
+		return fmt.Errorf("pod %s/%s on node %q has at least the priority of protected priority class %q", protected.Namespace, protected.Name, n.Name, k.protectedPriorityClass)
+	}
+
+	if k.rebootTaint != nil {
+		nodeLog(n).Infof("Tainting node %q with %q", n.Name, k.rebootTaint.ToString())
+	} else {
+		nodeLog(n).Infof("Marking node %q as unschedulable", n.Name)
+	}
+	err = k.updateNode(n.Name, func(node *v1api.Node) {
+		node.Annotations[constants.AnnotationRebootPhase] = constants.RebootPhaseDraining
+		if k.rebootTaint != nil {
+			taintNode(node, k.rebootTaint)
+			return
+		}
+		// nodes which are already unschedulable were cordoned by someone
+		// else, and are left unschedulable after the reboot
+		if node.Spec.Unschedulable {
+			if _, ok := node.Annotations[constants.AnnotationCordonedByOperator]; !ok {
+				node.Annotations[constants.AnnotationCordonedByOperator] = constants.False
+			}
+			return
+		}
+		node.Spec.Unschedulable = true
+		node.Annotations[constants.AnnotationCordonedByOperator] = constants.True
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark node %q as unschedulable: %v", n.Name, err)
+	}
+
+	if k.drainMode == drainModeCordonOnly {
+		nodeLog(n).Infof("Not evicting the pods of node %q: the drain mode is %q", n.Name, drainModeCordonOnly)
+		return nil
+	}
+
+	pods, err := drain.GetPodsForDeletion(k.kc, n.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get list of pods for deletion on node %q: %v", n.Name, err)
+	}
+
+	if k.dryRun {
+		for _, pod := range pods {
+			logging.Infof("Dry run: would evict pod %q in namespace %q from node %q", pod.Name, pod.Namespace, n.Name)
+		}
+		return nil
+	}
+
+	nodeLog(n).Infof("Evicting %d pods from node %q", len(pods), n.Name)
+	refused, err := k.evictPods(n, pods, stop)
+	if err != nil {
+		return err
+	}
+	if len(refused) > 0 {
+		for i := range refused {
+			pod := &refused[i]
+			k.er.Eventf(pod, v1api.EventTypeWarning, eventReasonPodEvictionFailed,
+				"Pod could not be evicted from node %q within %v", n.Name, k.drainTimeout)
+		}
+		if !k.drainForce {
+			return fmt.Errorf("%d pods could not be evicted from node %q within %v", len(refused), n.Name, k.drainTimeout)
+		}
+		nodeLog(n).Warningf("Deleting %d pods which could not be evicted from node %q within %v", len(refused), n.Name, k.drainTimeout)
+		if err := k.deletePods(refused); err != nil {
+			return err
+		}
+	}
+
+	// wait for the evicted pods to be deleted. pods which are still
+	// terminating when the grace period runs out are left for the
+	// update-agent, which deletes any remaining pods before it reboots.
+	timeout := time.NewTimer(k.drainGracePeriod)
+	defer timeout.Stop()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for !k.podsDeleted(pods) {
+		select {
+		case <-stop:
+			return fmt.Errorf("stopped while waiting for evicted pods to be deleted from node %q", n.Name)
+		case <-timeout.C:
+			nodeLog(n).Warningf("Not all evicted pods were deleted from node %q within %v", n.Name, k.drainGracePeriod)
+			return nil
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// nodeDrain is a drain of a node running in the background.
+type nodeDrain struct {
+	// closed to abort the drain
+	cancel chan struct{}
+	// closed once the drain returned err
+	done chan struct{}
+	err  error
+}
+
+// startDrain drains the given node with drainNode in the background, so the
+// reconciliation passes are not blocked while its pods are evicted. The drain
+// is aborted once the stop channel is closed or cancelDrains is called for
+// it. Its result is collected by a later pass with drainResult.
+func (k *Kontroller) startDrain(n *v1api.Node, stop <-chan struct{}) {
+	d := &nodeDrain{cancel: make(chan struct{}), done: make(chan struct{})}
+	k.drains[n.Name] = d
+	node := n.DeepCopy()
+
+	// aborted is closed once the drain is stopped or cancelled
+	aborted := make(chan struct{})
+	k.drainWG.Add(2)
+	go func() {
+		defer k.drainWG.Done()
+		select {
+		case <-stop:
+		case <-d.cancel:
+		case <-d.done:
+		}
+		close(aborted)
+	}()
+	go func() {
+		defer k.drainWG.Done()
+		defer close(d.done)
+		d.err = k.drainNode(node, aborted)
+	}()
+}
+
+// drainResult returns whether the named node is being drained by startDrain,
+// and if so whether the drain completed and its error. A completed drain is
+// forgotten, so the node is drained again if it is retried.
+func (k *Kontroller) drainResult(name string) (started, done bool, err error) {
+	d, ok := k.drains[name]
+	if !ok {
+		return false, false, nil
+	}
+	select {
+	case <-d.done:
+		delete(k.drains, name)
+		return true, true, d.err
+	default:
+		return true, false, nil
+	}
+}
+
+// cancelDrains aborts and forgets the drains of the nodes which are not among
+// the given nodes, e.g. because their reboot was aborted.
+func (k *Kontroller) cancelDrains(nodes []v1api.Node) {
+	names := make(map[string]bool, len(nodes))
+	for i := range nodes {
+		names[nodes[i].Name] = true
+	}
+	for name, d := range k.drains {
+		if !names[name] {
+			logging.V(4).Infof("Aborting the drain of node %q: it is no longer in its before-reboot checks", name)
+			close(d.cancel)
+			delete(k.drains, name)
+		}
+	}
+}
+
+// evictPods evicts the given pods from the node, retrying the evictions
+// refused because of a PodDisruptionBudget until the drain timeout. It returns
+// the pods whose eviction was still refused after the timeout. An error is
+// returned if an eviction fails for any other reason, or if the stop channel
+// is closed while retrying.
+func (k *Kontroller) evictPods(n *v1api.Node, pods []v1api.Pod, stop <-chan struct{}) ([]v1api.Pod, error) {
+	gracePeriod := int64(k.drainGracePeriod.Seconds())
+	deadline := time.Now().Add(k.drainTimeout)
+	for {
+		var refused []v1api.Pod
+		for _, pod := range pods {
+			logging.V(4).Infof("Evicting pod %q in namespace %q", pod.Name, pod.Namespace)
+			err := k.kc.CoreV1().Pods(pod.Namespace).Evict(&policy.Eviction{
+				ObjectMeta: v1meta.ObjectMeta{
+					Name:      pod.Name,
+					Namespace: pod.Namespace,
+				},
+				DeleteOptions: &v1meta.DeleteOptions{
+					GracePeriodSeconds: &gracePeriod,
+				},
+			})
+			if errors.IsNotFound(err) {
+				continue
+			}
+			if errors.IsTooManyRequests(err) {
+				logging.V(4).Infof("Eviction of pod %q in namespace %q refused: %v", pod.Name, pod.Namespace, err)
+				refused = append(refused, pod)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to evict pod %q in namespace %q: %v", pod.Name, pod.Namespace, err)
+			}
+		}
+
+		if len(refused) == 0 || !time.Now().Before(deadline) {
+			return refused, nil
+		}
+		pods = refused
+
+		nodeLog(n).Infof("Eviction of %d pods from node %q refused, retrying", len(pods), n.Name)
+		select {
+		case <-stop:
+			return nil, fmt.Errorf("stopped while evicting pods from node %q", n.Name)
+		case <-time.After(drainPollInterval):
+		}
+	}
+}
+
+// deletePods deletes the given pods, bypassing their PodDisruptionBudgets.
+// They are still given the drain grace period to terminate.
+func (k *Kontroller) deletePods(pods []v1api.Pod) error {
+	gracePeriod := int64(k.drainGracePeriod.Seconds())
+	for _, pod := range pods {
+		logging.V(4).Infof("Deleting pod %q in namespace %q", pod.Name, pod.Namespace)
+		err := k.kc.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &v1meta.DeleteOptions{
+			GracePeriodSeconds: &gracePeriod,
+			Preconditions:      &v1meta.Preconditions{UID: &pod.UID},
+		})
+		if errors.IsNotFound(err) || errors.IsConflict(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete pod %q in namespace %q: %v", pod.Name, pod.Namespace, err)
+		}
+	}
+	return nil
+}
+
+// uncordonIfCordonedByOperator marks the given node as schedulable if it was
+// cordoned by the update-operator. Nodes cordoned by anyone else are left
+// unschedulable.
+func uncordonIfCordonedByOperator(node *v1api.Node) {
+	if node.Annotations[constants.AnnotationCordonedByOperator] != constants.True {
+		delete(node.Annotations, constants.AnnotationCordonedByOperator)
+		return
+	}
+	logging.V(4).Infof("Marking node %q as schedulable", node.Name)
+	node.Spec.Unschedulable = false
+	delete(node.Annotations, constants.AnnotationCordonedByOperator)
+}
+
+// podsDeleted returns true if all of the given pods have been deleted.
+func (k *Kontroller) podsDeleted(pods []v1api.Pod) bool {
+	for _, pod := range pods {
+		p, err := k.kc.CoreV1().Pods(pod.Namespace).Get(pod.Name, v1meta.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		// most errors will be transient. log the error and check again
+		// later
+		if err != nil {
+			logging.Errorf("Failed to get pod %q: %v", pod.Name, err)
+			return false
+		}
+		if p.UID != pod.UID {
+			continue
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package operator
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	v1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/coreos/container-linux-update-operator/pkg/k8sutil"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+// updateNode applies f to the named node and updates it, retrying on
+// conflicts. All node updates of the update-operator go through updateNode or
+// updateListedNode, so listPassNodes knows when to list the nodes again. In
+// dry-run mode the node is not updated, and the changes f would make to it are
+// logged instead.
+func (k *Kontroller) updateNode(name string, f func(*v1api.Node)) error {
+	if !k.dryRun {
+		// make the next reconciliation phase list the nodes again, even if
+		// the update fails part way
+		defer atomic.AddUint64(&k.nodeUpdates, 1)
+		return k8sutil.UpdateNodeRetry(k.nc, name, f)
+	}
+
+	node, err := k.nc.Get(name, v1meta.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get node %q: %v", name, err)
+	}
+	updated := node.DeepCopy()
+	f(updated)
+	logNodeChanges(node, updated)
+	return nil
+}
+
+// updateListedNode applies f to the given node, as listed, and updates it
+// only if it has not changed since it was listed, based on its resource
+// version. It returns false if the node changed, e.g. because its
+// update-agent cancelled its reboot request, so decisions made on the listed
+// node are not applied to a node they no longer fit. The node is then
+// reconsidered on a later pass, against its current state. In dry-run mode
+// the node is not updated, and the changes f would make to it are logged
+// instead.
+func (k *Kontroller) updateListedNode(node *v1api.Node, f func(*v1api.Node)) (bool, error) {
+	updated := node.DeepCopy()
+	f(updated)
+	if k.dryRun {
+		logNodeChanges(node, updated)
+		return true, nil
+	}
+
+	// make the next reconciliation phase list the nodes again, even if the
+	// update fails
+	defer atomic.AddUint64(&k.nodeUpdates, 1)
+	_, err := k.nc.Update(updated)
+	if errors.IsConflict(err) {
+		logging.V(4).Infof("Node %q changed since it was listed, not updating it", node.Name)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update node %q: %v", node.Name, err)
+	}
+	return true, nil
+}
+
+// logNodeChanges logs the changes to the labels, annotations and
+// schedulability between the old and new version of a node.
+func logNodeChanges(old, new *v1api.Node) {
+	logMapChanges(old.Name, "label", old.Labels, new.Labels)
+	logMapChanges(old.Name, "annotation", old.Annotations, new.Annotations)
+	if old.Spec.Unschedulable != new.Spec.Unschedulable {
+		logging.Infof("Dry run: would mark node %q as unschedulable=%t", old.Name, new.Spec.Unschedulable)
+	}
+}
+
+func logMapChanges(node, kind string, old, new map[string]string) {
+	for k, v := range new {
+		if ov, ok := old[k]; !ok || ov != v {
+			logging.Infof("Dry run: would set %s %q to %q on node %q", kind, k, v, node)
+		}
+	}
+	for k := range old {
+		if _, ok := new[k]; !ok {
+			logging.Infof("Dry run: would delete %s %q from node %q", kind, k, node)
+		}
+	}
+}
+
+// dryRunEventRecorder is a record.EventRecorder which logs events instead of
+// recording them, so events in dry-run mode do not suggest the cluster was
+// changed.
+type dryRunEventRecorder struct{}
+
+var _ record.EventRecorder = dryRunEventRecorder{}
+
+func (dryRunEventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	logging.Infof("Dry run: would record %s event %s: %s", eventtype, reason, message)
+}
+
+func (r dryRunEventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r dryRunEventRecorder) PastEventf(object runtime.Object, timestamp v1meta.Time, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
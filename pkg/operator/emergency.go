@@ -0,0 +1,36 @@
+package operator
+
+import (
+	v1api "k8s.io/api/core/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+)
+
+// emergencyReboot returns true if the reboot of the given node is marked as
+// an emergency reboot by the administrator.
+func emergencyReboot(n *v1api.Node) bool {
+	return n.Annotations[constants.AnnotationRebootEmergency] == constants.True
+}
+
+// splitEmergencyNodes returns the given nodes with an emergency reboot, and
+// the others, each in their given order.
+func splitEmergencyNodes(nodes []v1api.Node) (emergency, scheduled []v1api.Node) {
+	for _, n := range nodes {
+		if emergencyReboot(&n) {
+			emergency = append(emergency, n)
+		} else {
+			scheduled = append(scheduled, n)
+		}
+	}
+	return emergency, scheduled
+}
+
+// reportEmergencyReboot logs, records a warning event and counts that the
+// given node was chosen to reboot as an emergency reboot, bypassing the reboot
+// freeze, the reboot window and the reboot cooldown.
+func (k *Kontroller) reportEmergencyReboot(n *v1api.Node) {
+	emergencyRebootsTotal.Inc()
+	nodeLog(n).With("reason", eventReasonEmergencyReboot).Warningf("Emergency reboot of node %q, bypassing the reboot freeze, window and cooldown", n.Name)
+	k.er.Event(n, v1api.EventTypeWarning, eventReasonEmergencyReboot,
+		"Emergency reboot, bypassing the reboot freeze, window and cooldown")
+}
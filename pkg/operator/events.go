@@ -0,0 +1,68 @@
+package operator
+
+import (
+	"fmt"
+	"time"
+
+	v1api "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+// rebootFailureEventWindow is the period of time after a reboot failure event
+// of a node during which further reboot failures of the node are not recorded
+// as events, but counted in the next event.
+const rebootFailureEventWindow = time.Hour
+
+// namespacedEventSink is a record.EventSink which records all events in a
+// single namespace, instead of the namespace of the object they are about.
+type namespacedEventSink struct {
+	sink      record.EventSink
+	namespace string
+}
+
+func (s *namespacedEventSink) Create(event *v1api.Event) (*v1api.Event, error) {
+	event.Namespace = s.namespace
+	return s.sink.Create(event)
+}
+
+func (s *namespacedEventSink) Update(event *v1api.Event) (*v1api.Event, error) {
+	event.Namespace = s.namespace
+	return s.sink.Update(event)
+}
+
+func (s *namespacedEventSink) Patch(event *v1api.Event, data []byte) (*v1api.Event, error) {
+	event.Namespace = s.namespace
+	return s.sink.Patch(event, data)
+}
+
+// rebootFailureEvent is the last reboot failure event recorded for a node.
+type rebootFailureEvent struct {
+	time time.Time
+	// number of reboot failures since, which were not recorded
+	suppressed int
+}
+
+// rebootFailureEventf records a warning event about a reboot failure of the
+// given node, unless one was already recorded for the node within the reboot
+// failure event window, so a node failing repeatedly does not flood the
+// events. The failures which were not recorded are counted in the next event.
+func (k *Kontroller) rebootFailureEventf(n *v1api.Node, reason, messageFmt string, args ...interface{}) {
+	now := time.Now()
+	message := fmt.Sprintf(messageFmt, args...)
+
+	last, ok := k.rebootFailureEvents[n.Name]
+	if ok && now.Sub(last.time) < rebootFailureEventWindow {
+		last.suppressed++
+		logging.V(4).Infof("Not recording %s event for node %q, %d failures since %s: %s",
+			reason, n.Name, last.suppressed, last.time.UTC().Format(time.RFC3339), message)
+		return
+	}
+	if ok && last.suppressed > 0 {
+		message = fmt.Sprintf("%s (%d more reboot failures since %s)", message, last.suppressed, last.time.UTC().Format(time.RFC3339))
+	}
+
+	k.rebootFailureEvents[n.Name] = &rebootFailureEvent{time: now}
+	k.er.Event(n, v1api.EventTypeWarning, reason, message)
+}
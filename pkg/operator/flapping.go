@@ -0,0 +1,84 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	v1api "k8s.io/api/core/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+)
+
+// defaultFlappingWindow is the period of time over which the reboots of a
+// node are counted to detect flapping, when no other value is configured.
+const defaultFlappingWindow = time.Hour
+
+// recordRebootCompletion records in the recent-reboots annotation of the given
+// node that it completed a reboot at the given time, if flapping detection is
+// enabled, forgetting the reboots outside the flapping window. As the reboots
+// are recorded on the node, they are still counted after the operator
+// restarted or another one took over. At most one more reboot than the
+// flapping threshold is kept.
+func (k *Kontroller) recordRebootCompletion(node *v1api.Node, now time.Time) {
+	if k.flappingReboots == 0 {
+		delete(node.Annotations, constants.AnnotationRecentReboots)
+		return
+	}
+	recent := append(k.recentRebootCompletions(node, now), now)
+	if len(recent) > k.flappingReboots+1 {
+		recent = recent[len(recent)-k.flappingReboots-1:]
+	}
+	times := make([]string, 0, len(recent))
+	for _, t := range recent {
+		times = append(times, t.UTC().Format(time.RFC3339))
+	}
+	node.Annotations[constants.AnnotationRecentReboots] = strings.Join(times, ",")
+}
+
+// recentRebootCompletions returns the times the given node completed a reboot
+// within the flapping window before now, as recorded in its recent-reboots
+// annotation. Invalid times are ignored.
+func (k *Kontroller) recentRebootCompletions(n *v1api.Node, now time.Time) []time.Time {
+	var recent []time.Time
+	for _, s := range strings.Split(n.Annotations[constants.AnnotationRecentReboots], ",") {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			continue
+		}
+		if now.Sub(t) < k.flappingWindow {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// flapping returns true if the given node wanting to reboot completed more
+// reboots than the flapping threshold within the flapping window, e.g.
+// because its update-agent requests a reboot again right after each reboot.
+func (k *Kontroller) flapping(n *v1api.Node) bool {
+	return k.flappingReboots > 0 && len(k.recentRebootCompletions(n, time.Now())) > k.flappingReboots
+}
+
+// excludeFlappingNode excludes the given flapping node from all actions of the
+// operator, by annotating it with exclude=true, instead of rebooting it again,
+// and reports it with a RebootFlapping event. Its reboots are forgotten, so
+// it is only excluded again if it flaps again once the annotation has been
+// removed by an administrator.
+func (k *Kontroller) excludeFlappingNode(n *v1api.Node) error {
+	reboots := len(k.recentRebootCompletions(n, time.Now()))
+	err := k.updateNode(n.Name, func(node *v1api.Node) {
+		node.Annotations[constants.AnnotationExclude] = constants.True
+		delete(node.Annotations, constants.AnnotationRecentReboots)
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to exclude flapping node %q: %v", n.Name, err)
+	}
+
+	flappingNodesTotal.Inc()
+	nodeLog(n).With("reason", eventReasonRebootFlapping).Warningf("Node %q rebooted %d times within %v and wants to reboot again, excluding it", n.Name, reboots, k.flappingWindow)
+	k.er.Eventf(n, v1api.EventTypeWarning, eventReasonRebootFlapping,
+		"Node rebooted %d times within %v and wants to reboot again, excluded from the update-operator until the %s annotation is removed",
+		reboots, k.flappingWindow, constants.AnnotationExclude)
+	return nil
+}
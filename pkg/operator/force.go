@@ -0,0 +1,64 @@
+package operator
+
+import (
+	"fmt"
+	"time"
+
+	v1api "k8s.io/api/core/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+)
+
+// markForcedReboots requests a reboot of the nodes which have been up for
+// longer than the configured force-reboot-after duration, as published by the
+// update-agent in the boot-time annotation, by setting reboot-needed to true
+// on behalf of the update-agent. The nodes are then rebooted like any node
+// requesting a reboot. Nodes without a boot-time annotation, nodes which
+// already want to reboot or are rebooting, and nodes with the off reboot
+// strategy are left alone.
+// If there is an error getting the list of nodes or updating any of them, an
+// error is immediately returned.
+func (k *Kontroller) markForcedReboots() error {
+	if k.forceRebootAfter == 0 {
+		return nil
+	}
+
+	nodelist, err := k.listPassNodes()
+	if err != nil {
+		return fmt.Errorf("Failed listing nodes: %v", err)
+	}
+
+	for i := range nodelist.Items {
+		n := &nodelist.Items[i]
+		if rebootRequested(n) {
+			continue
+		}
+		if rebootStrategy(n) == constants.RebootStrategyOff {
+			continue
+		}
+		booted, ok := annotationTime(n, constants.AnnotationBootTime)
+		if !ok {
+			continue
+		}
+		uptime := time.Since(booted)
+		if uptime <= k.forceRebootAfter {
+			continue
+		}
+
+		nodeLog(n).With("reason", eventReasonRebootForced).Infof("Requesting a reboot of node %q: it has been up since %s, more than %v", n.Name, booted.UTC().Format(time.RFC3339), k.forceRebootAfter)
+		// the update-agent may have requested a reboot in the meantime
+		requested, err := k.updateListedNode(n, func(node *v1api.Node) {
+			requestReboot(node, fmt.Sprintf("up for more than %v", k.forceRebootAfter))
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to update node %q: %v", n.Name, err)
+		}
+		if !requested {
+			continue
+		}
+		k.er.Eventf(n, v1api.EventTypeNormal, eventReasonRebootForced,
+			"Reboot requested by the operator: node has been up for more than %v", k.forceRebootAfter)
+	}
+
+	return nil
+}
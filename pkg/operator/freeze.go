@@ -0,0 +1,101 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+// freezeDateLayout is the layout of the dates of reboot freezes. Times may
+// also be given in RFC 3339 format.
+const freezeDateLayout = "2006-01-02"
+
+// rebootFreeze is a period of time during which no node may reboot,
+// regardless of the reboot window.
+type rebootFreeze struct {
+	// as configured, e.g. "2017-12-22/2018-01-02"
+	spec  string
+	start time.Time
+	end   time.Time
+}
+
+// parseRebootFreezes parses the given reboot freezes, each of the form
+// "start/end", where start and end are either dates, in which case the end
+// date is included in the freeze, or RFC 3339 times. Dates are interpreted
+// in the given location.
+func parseRebootFreezes(specs []string, loc *time.Location) ([]rebootFreeze, error) {
+	var freezes []rebootFreeze
+	for _, spec := range specs {
+		parts := strings.Split(spec, "/")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid reboot freeze %q, must be of the form start/end", spec)
+		}
+		start, err := parseFreezeTime(parts[0], loc, false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start of reboot freeze %q: %v", spec, err)
+		}
+		end, err := parseFreezeTime(parts[1], loc, true)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end of reboot freeze %q: %v", spec, err)
+		}
+		if !end.After(start) {
+			return nil, fmt.Errorf("invalid reboot freeze %q: it ends before it starts", spec)
+		}
+		freezes = append(freezes, rebootFreeze{spec: spec, start: start, end: end})
+	}
+	return freezes, nil
+}
+
+// parseFreezeTime parses the given date or RFC 3339 time. An end date is the
+// end of that day.
+func parseFreezeTime(s string, loc *time.Location, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation(freezeDateLayout, s, loc); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date like %s nor an RFC 3339 time", s, freezeDateLayout)
+	}
+	return t, nil
+}
+
+// recordRebootFreeze records the given reboot freeze as the one in effect in
+// the metrics and the status, and logs its start and end.
+func (k *Kontroller) recordRebootFreeze(freeze *rebootFreeze) {
+	spec := ""
+	if freeze != nil {
+		spec = freeze.spec
+		rebootFreezeActive.Set(1)
+	} else {
+		rebootFreezeActive.Set(0)
+	}
+
+	k.statusMu.Lock()
+	defer k.statusMu.Unlock()
+	if spec == k.status.RebootFreeze {
+		return
+	}
+	if spec != "" {
+		logging.Infof("Reboot freeze %s started, not allowing any node to reboot until %v", spec, freeze.end)
+	} else {
+		logging.Infof("Reboot freeze %s ended", k.status.RebootFreeze)
+	}
+	k.status.RebootFreeze = spec
+}
+
+// activeRebootFreeze returns the configured reboot freeze the given time is
+// in, or nil if none.
+func (k *Kontroller) activeRebootFreeze(now time.Time) *rebootFreeze {
+	for i := range k.rebootFreezes {
+		f := &k.rebootFreezes[i]
+		if !now.Before(f.start) && now.Before(f.end) {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package operator
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// setLeading records whether this operator currently holds the leader election
+// lock.
+func (k *Kontroller) setLeading(leading bool) {
+	var v int32
+	if leading {
+		v = 1
+	}
+	atomic.StoreInt32(&k.leading, v)
+}
+
+// ready returns true if this operator holds the leader election lock and has
+// successfully listed the nodes since.
+func (k *Kontroller) ready() bool {
+	return atomic.LoadInt32(&k.leading) == 1 && atomic.LoadInt32(&k.nodesListed) == 1
+}
+
+// healthzHandler reports the operator as healthy whenever it serves requests.
+func (k *Kontroller) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok\n"))
+}
+
+// readyzHandler reports the operator as ready once it is the leader and has
+// successfully listed the nodes.
+func (k *Kontroller) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if !k.ready() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok\n"))
+}
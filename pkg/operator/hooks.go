@@ -0,0 +1,112 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+const (
+	// defaultRebootHookTimeout is the time a reboot hook is given to
+	// complete when no other value is configured.
+	defaultRebootHookTimeout = 10 * time.Minute
+	// defaultRebootPredicateTimeout is the time a reboot predicate hook is
+	// given to complete when no other value is configured. It is short, as
+	// predicates are run for each candidate during a reconciliation pass.
+	defaultRebootPredicateTimeout = 30 * time.Second
+
+	// maxHookOutput is the maximum length of hook output included in errors.
+	maxHookOutput = 512
+)
+
+// runHook runs the given hook for a node and waits for it to succeed.
+// A hook is either a command or an http or https URL. The name of the node is
+// passed to a command as its only argument, and in the NODE_NAME environment
+// variable. A URL is requested with a GET request, with the name of the node in
+// the node query parameter, and must respond with a 2xx status code.
+// The hook is aborted if it does not complete within the reboot hook timeout,
+// or if the stop channel is closed.
+func (k *Kontroller) runHook(hook, node string, stop <-chan struct{}) error {
+	return k.runHookWithTimeout(hook, node, k.rebootHookTimeout, stop)
+}
+
+// runHookWithTimeout runs the given hook for a node like runHook, aborting it
+// if it does not complete within the given timeout.
+func (k *Kontroller) runHookWithTimeout(hook, node string, timeout time.Duration, stop <-chan struct{}) error {
+	if k.dryRun {
+		logging.Infof("Dry run: would run hook %q for node %q", hook, node)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	logging.Infof("Running hook %q for node %q", hook, node)
+	if strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://") {
+		err := probeHook(ctx, hook, node)
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("hook %q did not complete within %v", hook, timeout)
+		}
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, hook, node)
+	cmd.Env = append(os.Environ(), "NODE_NAME="+node)
+	out, err := cmd.CombinedOutput()
+	logging.V(4).Infof("Output of hook %q for node %q: %s", hook, node, out)
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("hook %q did not complete within %v", hook, timeout)
+	}
+	if err != nil {
+		output := strings.TrimSpace(string(out))
+		if len(output) > maxHookOutput {
+			output = output[len(output)-maxHookOutput:]
+		}
+		return fmt.Errorf("hook %q failed: %v: %s", hook, err, output)
+	}
+	return nil
+}
+
+// probeHook requests the given hook URL for a node and checks the response
+// status code.
+func probeHook(ctx context.Context, hook, node string) error {
+	u, err := url.Parse(hook)
+	if err != nil {
+		return fmt.Errorf("invalid hook URL %q: %v", hook, err)
+	}
+	q := u.Query()
+	q.Set("node", node)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("invalid hook URL %q: %v", hook, err)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("hook %q failed: %v", hook, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxHookOutput))
+		return fmt.Errorf("hook %q failed with status %s: %s", hook, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package operator
+
+import (
+	"time"
+
+	v1api "k8s.io/api/core/v1"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// instrumentedNodes records the number and latency of the node requests the
+// update-operator makes to the apiserver, by verb, in the apiserver request
+// metrics. The requests it does not make are passed through unrecorded.
+type instrumentedNodes struct {
+	v1core.NodeInterface
+}
+
+// observeNodeRequest records a node request with the given verb which started at the given
+// time and completed with the given error.
+func observeNodeRequest(verb string, started time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	apiserverRequestsTotal.WithLabelValues("nodes", verb, result).Inc()
+	apiserverRequestDurationSeconds.WithLabelValues("nodes", verb).Observe(time.Since(started).Seconds())
+}
+
+func (c instrumentedNodes) Get(name string, options v1meta.GetOptions) (*v1api.Node, error) {
+	started := time.Now()
+	node, err := c.NodeInterface.Get(name, options)
+	observeNodeRequest("get", started, err)
+	return node, err
+}
+
+func (c instrumentedNodes) List(opts v1meta.ListOptions) (*v1api.NodeList, error) {
+	started := time.Now()
+	nodes, err := c.NodeInterface.List(opts)
+	observeNodeRequest("list", started, err)
+	return nodes, err
+}
+
+// Watch records the time until the watch is established, not its duration.
+func (c instrumentedNodes) Watch(opts v1meta.ListOptions) (watch.Interface, error) {
+	started := time.Now()
+	w, err := c.NodeInterface.Watch(opts)
+	observeNodeRequest("watch", started, err)
+	return w, err
+}
+
+func (c instrumentedNodes) Update(node *v1api.Node) (*v1api.Node, error) {
+	started := time.Now()
+	updated, err := c.NodeInterface.Update(node)
+	observeNodeRequest("update", started, err)
+	return updated, err
+}
+
+func (c instrumentedNodes) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (*v1api.Node, error) {
+	started := time.Now()
+	patched, err := c.NodeInterface.Patch(name, pt, data, subresources...)
+	observeNodeRequest("patch", started, err)
+	return patched, err
+}
@@ -0,0 +1,48 @@
+package operator
+
+import (
+	"os"
+	"time"
+
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+	"github.com/coreos/container-linux-update-operator/pkg/k8sutil"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+const (
+	// annotations set on the leader election lock by the operator holding it,
+	// following the label and annotation prefix
+	annotationLeaderPodName  = "leader-pod-name"
+	annotationLeaderHostname = "leader-hostname"
+	annotationLeaderSince    = "leader-since"
+)
+
+// recordLeader annotates the leader election lock with the pod name, taken
+// from the POD_NAME environment variable, and hostname of this operator, and
+// the time it became the leader. This makes the active operator easy to find.
+// Failing to do so is logged but not fatal, since it is only informational.
+func (k *Kontroller) recordLeader(hostname string) {
+	podName := os.Getenv("POD_NAME")
+	since := time.Now().UTC().Format(time.RFC3339)
+	cms := k.leaderElectionClient.CoreV1().ConfigMaps(k.leaderElectionNamespace)
+
+	err := k8sutil.RetryOnConflict(k8sutil.DefaultBackoff, func() error {
+		cm, err := cms.Get(k.leaderElectionName, v1meta.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if cm.Annotations == nil {
+			cm.Annotations = make(map[string]string)
+		}
+		cm.Annotations[constants.Prefix+annotationLeaderPodName] = podName
+		cm.Annotations[constants.Prefix+annotationLeaderHostname] = hostname
+		cm.Annotations[constants.Prefix+annotationLeaderSince] = since
+		_, err = cms.Update(cm)
+		return err
+	})
+	if err != nil {
+		logging.Warningf("Failed to record leader on ConfigMap %s/%s: %v", k.leaderElectionNamespace, k.leaderElectionName, err)
+	}
+}
@@ -0,0 +1,186 @@
+package operator
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+const metricsNamespace = "cluo"
+
+var (
+	rebootsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reboots_total",
+		Help:      "Number of node reboots completed.",
+	})
+
+	flappingNodesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "flapping_nodes_total",
+		Help:      "Number of nodes excluded because they rebooted more than the flapping threshold within the flapping window.",
+	})
+
+	emergencyRebootsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "emergency_reboots_total",
+		Help:      "Number of nodes chosen to reboot as emergency reboots, bypassing the reboot freeze, window and cooldown.",
+	})
+
+	rebootFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reboot_failures_total",
+		Help:      "Number of node reboots which did not complete within the reboot timeout.",
+	})
+
+	nodesWantingReboot = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "nodes_wanting_reboot",
+		Help:      "Number of nodes which want to reboot and have not been allowed to yet.",
+	})
+
+	rebootWindowOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "reboot_window_open",
+		Help:      "Whether nodes are currently allowed to reboot by the reboot window, 1 if they are or no reboot window is configured, 0 otherwise.",
+	})
+
+	rebootFreezeActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "reboot_freeze_active",
+		Help:      "Whether a reboot freeze is in effect, during which no node is allowed to reboot, 1 if one is, 0 otherwise.",
+	})
+
+	rebootsHaltedGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "reboots_halted",
+		Help:      "Whether reboots are halted because the maximum number of consecutive reboot failures was reached, 1 if they are, 0 otherwise.",
+	})
+
+	rebootDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "reboot_duration_seconds",
+		Help:      "Time from allowing a node to reboot until its reboot has completed.",
+		// 30s to ~8.5h
+		Buckets: prometheus.ExponentialBuckets(30, 2, 10),
+	})
+
+	apiserverRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "apiserver_requests_total",
+		Help:      "Number of requests made to the apiserver, by resource, verb and result, either success or error.",
+	}, []string{"resource", "verb", "result"})
+
+	apiserverRequestDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "apiserver_request_duration_seconds",
+		Help:      "Latency of the requests made to the apiserver, by resource and verb.",
+		// 5ms to ~10s
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"resource", "verb"})
+)
+
+// newMetricsRegistry returns a registry with all update-operator metrics
+// registered. A dedicated registry is used so only our own metrics are
+// exposed.
+func newMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		rebootsTotal,
+		emergencyRebootsTotal,
+		flappingNodesTotal,
+		rebootFailuresTotal,
+		nodesWantingReboot,
+		rebootWindowOpen,
+		rebootFreezeActive,
+		rebootsHaltedGauge,
+		rebootDurationSeconds,
+		apiserverRequestsTotal,
+		apiserverRequestDurationSeconds,
+	)
+	return registry
+}
+
+// serveHTTP serves the metrics, the health and readiness endpoints and the
+// status, configuration and reboot plan of the update-operator on the
+// configured listen address until the stop channel is closed.
+func (k *Kontroller) serveHTTP(stop <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(k.metricsRegistry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", k.healthzHandler)
+	mux.HandleFunc("/readyz", k.readyzHandler)
+	mux.HandleFunc("/status", k.statusHandler)
+	mux.HandleFunc("/config", k.configHandler)
+	mux.HandleFunc("/plan", k.planHandler)
+
+	server := &http.Server{
+		Addr:      k.listenAddress,
+		Handler:   mux,
+		TLSConfig: k.tlsConfig,
+	}
+
+	go func() {
+		<-stop
+		server.Close()
+	}()
+
+	var err error
+	if k.tlsConfig != nil {
+		logging.Infof("Serving metrics and health endpoints on %s with TLS", k.listenAddress)
+		// the certificate is already loaded in the TLS configuration
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		logging.Infof("Serving metrics and health endpoints on %s", k.listenAddress)
+		err = server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		logging.Errorf("Failed to serve metrics and health endpoints: %v", err)
+	}
+}
+
+// newTLSConfig returns the TLS configuration to serve the metrics and health
+// endpoints with the given certificate and key files, or nil if none are
+// given. If a client CA file is given, clients must present a certificate
+// signed by one of its CA certificates.
+func newTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, fmt.Errorf("TLS client CA file requires a TLS certificate and key file")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("TLS certificate and key files must be given together")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load TLS certificate: %v", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read TLS client CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in TLS client CA file %q", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
@@ -0,0 +1,76 @@
+package operator
+
+import (
+	"fmt"
+	"os"
+
+	v1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// mirrorReasons are the reasons of the node events which are mirrored to the
+// operator, when mirroring is enabled.
+var mirrorReasons = map[string]bool{
+	eventReasonRebootStarted:   true,
+	eventReasonRebootSucceeded: true,
+	eventReasonRebootFailed:    true,
+	eventReasonRebootDeferred:  true,
+}
+
+// mirroringEventRecorder is a record.EventRecorder which also records the
+// reboot decisions about nodes on a single object representing the operator,
+// so they can be reviewed in one place, e.g. with `kubectl describe`.
+type mirroringEventRecorder struct {
+	record.EventRecorder
+	target *v1api.ObjectReference
+}
+
+var _ record.EventRecorder = mirroringEventRecorder{}
+
+// newMirroringEventRecorder returns an event recorder mirroring the reboot
+// decisions recorded with er to the pod of the operator, named by the POD_NAME
+// environment variable in the given namespace, or to the given leader election
+// lock if the operator does not run in a pod.
+func newMirroringEventRecorder(er record.EventRecorder, namespace string, lock *v1api.ObjectReference) mirroringEventRecorder {
+	target := lock
+	if podName := os.Getenv("POD_NAME"); podName != "" {
+		target = &v1api.ObjectReference{
+			Kind:       "Pod",
+			APIVersion: "v1",
+			Namespace:  namespace,
+			Name:       podName,
+		}
+	}
+	return mirroringEventRecorder{EventRecorder: er, target: target}
+}
+
+func (r mirroringEventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.EventRecorder.Event(object, eventtype, reason, message)
+	r.mirror(object, eventtype, reason, message)
+}
+
+func (r mirroringEventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r mirroringEventRecorder) PastEventf(object runtime.Object, timestamp v1meta.Time, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.EventRecorder.PastEventf(object, timestamp, eventtype, reason, messageFmt, args...)
+	r.mirror(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r mirroringEventRecorder) mirror(object runtime.Object, eventtype, reason, message string) {
+	if !mirrorReasons[reason] {
+		return
+	}
+	if _, ok := object.(*v1api.Node); !ok {
+		return
+	}
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return
+	}
+	r.EventRecorder.Eventf(r.target, eventtype, reason, "Node %s: %s", accessor.GetName(), message)
+}
@@ -0,0 +1,78 @@
+package operator
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+	"github.com/coreos/container-linux-update-operator/pkg/notifier"
+)
+
+// notifyReasons are the reasons of the events which are also sent to the
+// notifier.
+var notifyReasons = map[string]bool{
+	eventReasonRebootStarted:   true,
+	eventReasonRebootSucceeded: true,
+	eventReasonRebootFailed:    true,
+	eventReasonAgentMissing:    true,
+	eventReasonRebootsHalted:   true,
+	eventReasonRebootBacklog:   true,
+	eventReasonRebootFlapping:  true,
+}
+
+// notifyingEventRecorder is a record.EventRecorder which also sends the events
+// about node reboots to a notifier. Notifications are sent in the background,
+// so a slow or failing notifier does not hold up the reboots, and failures
+// are only logged.
+type notifyingEventRecorder struct {
+	record.EventRecorder
+	notifier notifier.Notifier
+	cluster  string
+}
+
+var _ record.EventRecorder = notifyingEventRecorder{}
+
+func (r notifyingEventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.EventRecorder.Event(object, eventtype, reason, message)
+	r.notify(object, eventtype, reason, message)
+}
+
+func (r notifyingEventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r notifyingEventRecorder) PastEventf(object runtime.Object, timestamp v1meta.Time, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.EventRecorder.PastEventf(object, timestamp, eventtype, reason, messageFmt, args...)
+	r.notify(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r notifyingEventRecorder) notify(object runtime.Object, eventtype, reason, message string) {
+	if !notifyReasons[reason] {
+		return
+	}
+
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		logging.Errorf("Failed to send %s notification: %v", reason, err)
+		return
+	}
+
+	n := notifier.Notification{
+		Cluster: r.cluster,
+		Node:    accessor.GetName(),
+		Reason:  reason,
+		Type:    eventtype,
+		Message: message,
+		Time:    time.Now().UTC(),
+	}
+	go func() {
+		if err := r.notifier.Notify(n); err != nil {
+			logging.With("node", n.Node).With("reason", reason).Errorf("Failed to send %s notification for node %q: %v", reason, n.Node, err)
+		}
+	}()
+}
@@ -1,44 +1,120 @@
 package operator
 
 import (
+	"crypto/tls"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
 	v1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
 	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
 
 	"github.com/coreos/container-linux-update-operator/pkg/constants"
 	"github.com/coreos/container-linux-update-operator/pkg/k8sutil"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+	"github.com/coreos/container-linux-update-operator/pkg/notifier"
+	"github.com/coreos/container-linux-update-operator/pkg/version"
 	"github.com/coreos/locksmith/pkg/timeutil"
 )
 
 const (
+	eventReasonRebootStarted           = "RebootStarted"
+	eventReasonRebootSucceeded         = "RebootSucceeded"
 	eventReasonRebootFailed            = "RebootFailed"
+	eventReasonBeforeRebootHookFailed  = "BeforeRebootHookFailed"
+	eventReasonAfterRebootHookFailed   = "AfterRebootHookFailed"
+	eventReasonRebootDeferred          = "RebootDeferred"
+	eventReasonAgentMissing            = "AgentMissing"
+	eventReasonRebootRequestExpired    = "RebootRequestExpired"
+	eventReasonRebootForced            = "RebootForced"
+	eventReasonDrainBlocked            = "DrainBlocked"
+	eventReasonPodEvictionFailed       = "PodEvictionFailed"
+	eventReasonRebootsHalted           = "RebootsHalted"
+	eventReasonBatchStarted            = "BatchStarted"
+	eventReasonBatchFinished           = "BatchFinished"
+	eventReasonRebootBacklog           = "RebootBacklog"
+	eventReasonNodeDeleted             = "NodeDeleted"
+	eventReasonRebootAborted           = "RebootAborted"
+	eventReasonEmergencyReboot         = "EmergencyReboot"
+	eventReasonRebootFlapping          = "RebootFlapping"
+	eventReasonRebootPolicyInvalid     = "RebootPolicyInvalid"
 	eventSourceComponent               = "update-operator"
 	leaderElectionEventSourceComponent = "update-operator-leader-election"
 	// agentDefaultAppName is the label value for the 'app' key that agents are
 	// expected to be labeled with.
 	agentDefaultAppName = "container-linux-update-agent"
-	maxRebootingNodes   = 1
+	// defaultMaxRebootingNodes is the number of nodes allowed to reboot at the
+	// same time when no other value is configured.
+	defaultMaxRebootingNodes = 1
 
-	leaderElectionResourceName = "container-linux-update-operator-lock"
+	defaultLeaderElectionName = "container-linux-update-operator-lock"
 
 	// Arbitrarily copied from KVO
 	leaderElectionLease = 90 * time.Second
 	// ReconciliationPeriod
 	reconciliationPeriod = 30 * time.Second
+	// maxListFailureBackoff is the maximum period between reconciliations
+	// while listing the nodes keeps failing, which doubles the period after
+	// each consecutive failure.
+	maxListFailureBackoff = 5 * time.Minute
+
+	// pauseConfigMapName is the name of the ConfigMap in the namespace of the
+	// operator which may be used to pause all reboots, by setting its
+	// pauseConfigMapKey to "true".
+	pauseConfigMapName = "container-linux-update-operator-config"
+	pauseConfigMapKey  = "reboot-paused"
+
+	// defaultReconcileQPS and defaultReconcileBurst limit how often node
+	// changes may cause a reconciliation when no other values are configured,
+	// so a burst of node updates results in a single pass.
+	defaultReconcileQPS   = 0.2
+	defaultReconcileBurst = 1
+
+	// defaultMaxRebootCandidates is the number of nodes wanting to reboot
+	// which are evaluated for a reboot in each pass, when no other value is
+	// configured.
+	defaultMaxRebootCandidates = 50
+
+	// defaultResultQueueSize is the number of reboot results buffered for
+	// delivery, when no other value is configured.
+	defaultResultQueueSize = 100
+
+	// defaultCleanupConcurrency is the number of rebooted nodes updated at
+	// once by the after-reboot cleanup, when no other value is configured.
+	defaultCleanupConcurrency = 5
+
+	// defaultRebootTimeout is the time a node is given to complete its reboot
+	// after it has been allowed to reboot, when no other value is configured.
+	defaultRebootTimeout = time.Hour
+
+	// windowClosedReportPeriod is how often nodes waiting for the reboot
+	// window to open are reported.
+	windowClosedReportPeriod = 30 * time.Minute
+
+	// defaultEtcdMaxConcurrency is the number of nodes hosting etcd members
+	// allowed to reboot at the same time when no other value is configured.
+	// Rebooting a single member at a time keeps the quorum of any etcd
+	// cluster of three or more members.
+	defaultEtcdMaxConcurrency = 1
 )
 
 var (
@@ -49,11 +125,7 @@ var (
 	// trigger a reboot, and the update-agent sets
 	// constants.AnnotationRebootNeeded and
 	// constants.AnnotationRebootInProgress to false when it has finished.
-	justRebootedSelector = fields.Set(map[string]string{
-		constants.AnnotationOkToReboot:       constants.True,
-		constants.AnnotationRebootNeeded:     constants.False,
-		constants.AnnotationRebootInProgress: constants.False,
-	}).AsSelector()
+	justRebootedSelector fields.Selector
 
 	// wantsRebootSelector is a selector for the annotation expected to be on a node when it wants to be rebooted.
 	//
@@ -61,50 +133,331 @@ var (
 	// it would like to reboot, and false when it starts up.
 	//
 	// If constants.AnnotationRebootPaused is set to "true", the update-agent will not consider it for rebooting.
-	wantsRebootSelector = fields.ParseSelectorOrDie(constants.AnnotationRebootNeeded + "==" + constants.True +
-		"," + constants.AnnotationRebootPaused + "!=" + constants.True +
-		"," + constants.AnnotationOkToReboot + "!=" + constants.True +
-		"," + constants.AnnotationRebootInProgress + "!=" + constants.True)
+	wantsRebootSelector fields.Selector
 
 	// stillRebootingSelector is a selector for the annotation set expected to be
 	// on a node when it's in the process of rebooting
-	stillRebootingSelector = fields.Set(map[string]string{
-		constants.AnnotationOkToReboot:   constants.True,
-		constants.AnnotationRebootNeeded: constants.True,
-	}).AsSelector()
+	stillRebootingSelector fields.Selector
+
+	// okToRebootSelector is a selector for nodes the update-operator has
+	// allowed to reboot and which have not completed their reboot yet.
+	okToRebootSelector fields.Selector
 
 	// beforeRebootReq requires a node to be waiting for before reboot checks to complete
-	beforeRebootReq = k8sutil.NewRequirementOrDie(constants.LabelBeforeReboot, selection.In, []string{constants.True})
+	beforeRebootReq *labels.Requirement
 
 	// afterRebootReq requires a node to be waiting for after reboot checks to complete
-	afterRebootReq = k8sutil.NewRequirementOrDie(constants.LabelAfterReboot, selection.In, []string{constants.True})
+	afterRebootReq *labels.Requirement
 
 	// notBeforeRebootReq and notAfterRebootReq are the inverse of the above checks
-	notBeforeRebootReq = k8sutil.NewRequirementOrDie(constants.LabelBeforeReboot, selection.NotIn, []string{constants.True})
-	notAfterRebootReq  = k8sutil.NewRequirementOrDie(constants.LabelAfterReboot, selection.NotIn, []string{constants.True})
+	notBeforeRebootReq *labels.Requirement
+	notAfterRebootReq  *labels.Requirement
+
+	// updateAgentLabelMissingReq requires a node to lack the update-agent
+	// label
+	updateAgentLabelMissingReq *labels.Requirement
 )
 
+// initSelectors builds the selectors and requirements above from the label
+// and annotation keys, which depend on the configured prefix. An error is
+// returned if the keys are invalid, rather than panicking.
+func initSelectors() error {
+	var err error
+	justRebootedSelector = fields.Set(map[string]string{
+		constants.AnnotationOkToReboot:       constants.True,
+		constants.AnnotationRebootNeeded:     constants.False,
+		constants.AnnotationRebootInProgress: constants.False,
+	}).AsSelector()
+	wantsRebootSelector, err = fields.ParseSelector(constants.AnnotationRebootNeeded + "==" + constants.True +
+		"," + constants.AnnotationRebootPaused + "!=" + constants.True +
+		"," + constants.AnnotationOkToReboot + "!=" + constants.True +
+		"," + constants.AnnotationRebootInProgress + "!=" + constants.True)
+	if err != nil {
+		return err
+	}
+	stillRebootingSelector = fields.Set(map[string]string{
+		constants.AnnotationOkToReboot:   constants.True,
+		constants.AnnotationRebootNeeded: constants.True,
+	}).AsSelector()
+	okToRebootSelector = fields.Set(map[string]string{
+		constants.AnnotationOkToReboot: constants.True,
+	}).AsSelector()
+	if beforeRebootReq, err = labels.NewRequirement(constants.LabelBeforeReboot, selection.In, []string{constants.True}); err != nil {
+		return err
+	}
+	if afterRebootReq, err = labels.NewRequirement(constants.LabelAfterReboot, selection.In, []string{constants.True}); err != nil {
+		return err
+	}
+	if notBeforeRebootReq, err = labels.NewRequirement(constants.LabelBeforeReboot, selection.NotIn, []string{constants.True}); err != nil {
+		return err
+	}
+	if notAfterRebootReq, err = labels.NewRequirement(constants.LabelAfterReboot, selection.NotIn, []string{constants.True}); err != nil {
+		return err
+	}
+	if updateAgentLabelMissingReq, err = labels.NewRequirement(constants.LabelUpdateAgentEnabled, selection.DoesNotExist, []string{}); err != nil {
+		return err
+	}
+	return nil
+}
+
 type Kontroller struct {
 	kc kubernetes.Interface
 	nc v1core.NodeInterface
 	er record.EventRecorder
+	// timeout of the requests made with kc, no timeout if 0
+	clientTimeout time.Duration
 
 	// annotations to look for before and after reboots
 	beforeRebootAnnotations []string
 	afterRebootAnnotations  []string
-
-	leaderElectionClient        *kubernetes.Clientset
+	// selects the pods which must be ready on a node after its reboot, nil
+	// if none must be
+	afterRebootPodSelector labels.Selector
+	// time a node is left to settle after its after-reboot annotations are
+	// set, and when they were first seen set on each node in the after-reboot
+	// checks, keyed by node name
+	postRebootDelay   time.Duration
+	afterRebootSettle map[string]time.Time
+
+	leaderElectionClient        kubernetes.Interface
 	leaderElectionEventRecorder record.EventRecorder
+	// name and namespace of the leader election lock
+	leaderElectionName      string
+	leaderElectionNamespace string
 	// namespace is the kubernetes namespace any resources (e.g. locks,
 	// configmaps, agents) should be created and read under.
 	// It will be set to the namespace the operator is running in automatically.
 	namespace string
+	// name of the node the operator runs on, which is rebooted last
+	operatorNode string
 
 	// auto-label Container Linux nodes for migration compatability
 	autoLabelContainerLinux bool
 
-	// reboot window
-	rebootWindow *timeutil.Periodic
+	// selector for the nodes managed by the operator, and the names of the
+	// only nodes managed, all nodes matching the selector if nil
+	nodeSelector labels.Selector
+	nodeNames    map[string]bool
+
+	// name of the RebootPolicy overriding the flags, disabled if empty, the
+	// last RebootPolicy loaded, empty if none, and the settings configured
+	// by the flags
+	rebootPolicyName   string
+	rebootPolicyLoaded string
+	flagSettings       policySettings
+	// further restricts the managed nodes, as set by the RebootPolicy, nil
+	// if not restricted
+	policyNodeSelector labels.Selector
+
+	// reboot window and the location its times are interpreted in, and the
+	// last time nodes waiting for it to open were reported
+	rebootWindow         *timeutil.Periodic
+	rebootWindowLocation *time.Location
+	windowClosedReported time.Time
+	// periods during which no node may reboot, regardless of the reboot
+	// window
+	rebootFreezes []rebootFreeze
+
+	// maximum number of nodes allowed to reboot at the same time, either
+	// absolute or relative to the number of nodes if maxUnavailable is set
+	maxRebootingNodes int
+	maxUnavailable    *intstr.IntOrString
+	// maximum number of rebooting nodes set in the pause ConfigMap, which
+	// overrides the configured maximum if positive
+	maxRebootingNodesOverride int
+
+	// also reboot nodes which are not ready
+	rebootNotReady bool
+	// only reboot the nodes updated to this Container Linux version, all
+	// nodes if empty
+	rebootOSVersion string
+
+	// order in which nodes wanting to reboot are considered
+	rebootOrder nodeLess
+	// time each node was last chosen to reboot, keyed by node name. The
+	// nodes chosen longest ago, or never, are considered first, so a node
+	// which keeps failing to reboot does not starve the others. Nodes are
+	// removed once they rebooted successfully.
+	rebootAttempts map[string]time.Time
+	// reboot worker and control-plane nodes in separate phases
+	separateControlPlane bool
+	// label grouping nodes into reboot batches, disabled if empty, and the
+	// value of the label of the batch being rebooted, if one is active
+	batchLabel  string
+	batch       string
+	batchActive bool
+
+	// selects the nodes hosting etcd members, nil if unknown, and the maximum
+	// number of them allowed to reboot at the same time
+	etcdNodeSelector   labels.Selector
+	etcdMaxConcurrency int
+
+	// maximum number of nodes in the same zone allowed to reboot at the same
+	// time, unlimited if 0
+	maxRebootingNodesPerZone int
+
+	// minimum number of ready, schedulable nodes which are not rebooting,
+	// disabled if 0
+	minReadyNodes int
+
+	// maximum number of nodes wanting to reboot which are evaluated for a
+	// reboot in each pass
+	maxRebootCandidates int
+
+	// maximum number of rebooted nodes updated at once by the after-reboot
+	// cleanup
+	cleanupConcurrency int
+
+	// queue the result of each reboot is posted from, nil if disabled, and
+	// the identifier of the cluster included in the results
+	results     *notifier.ResultQueue
+	clusterName string
+
+	// commands or URLs which must succeed for a node to be chosen to reboot,
+	// and the time they are given to complete for each node
+	rebootPredicateHooks   []string
+	rebootPredicateTimeout time.Duration
+	// commands to run before allowing a node to reboot and after it has
+	// rebooted, and the time they are given to complete
+	beforeRebootHook  string
+	afterRebootHook   string
+	rebootHookTimeout time.Duration
+	// hold nodes whose after-reboot hook fails instead of releasing them
+	afterRebootHookKeepCordoned bool
+
+	// drain nodes before allowing them to reboot, evicting their pods unless
+	// the drain mode is cordon-only
+	drainBeforeReboot bool
+	drainMode         string
+	drainGracePeriod  time.Duration
+	// how long refused evictions are retried, and whether the pods which
+	// could still not be evicted are deleted instead of deferring the reboot
+	drainTimeout time.Duration
+	drainForce   bool
+	// drains running in the background, by node name, only used by the
+	// reconciliation passes, and the goroutines running them, waited for by
+	// Run
+	drains  map[string]*nodeDrain
+	drainWG sync.WaitGroup
+	// name of the PriorityClass whose pods, and pods of higher priority, are
+	// never evicted. Nodes running such pods are not rebooted.
+	protectedPriorityClass string
+	// NoSchedule taint added to nodes before they reboot, instead of
+	// cordoning them, nil to cordon them
+	rebootTaint *v1api.Taint
+
+	// time a node is given to complete its reboot after reboot-ok is set
+	rebootTimeout time.Duration
+	// number of times a node is given another reboot timeout before its
+	// reboot is reported as failed
+	rebootMaxRetries int
+	// nodes whose reboot has been reported as failed, keyed by node name
+	failedReboots map[string]bool
+	// last reboot failure event of each node, keyed by node name
+	rebootFailureEvents map[string]*rebootFailureEvent
+	// number of reboot timeouts seen for the current reboot of a node, keyed
+	// by node name
+	rebootRetries map[string]int
+	// uptime after which the operator requests a reboot of a node, disabled
+	// if 0
+	forceRebootAfter time.Duration
+	// age after which reboot requests are ignored, disabled if 0, and the
+	// reboot-needed-time of the expired requests already reported, keyed by
+	// node name
+	rebootRequestTTL      time.Duration
+	expiredRebootRequests map[string]string
+	// nodes awaiting the approval of their reboot which have been reported,
+	// keyed by node name
+	awaitingApprovalReported map[string]bool
+	// why nodes were last reported as deferred by an event, keyed by node
+	// name, so each deferral is only reported once
+	deferralsReported map[string]string
+	// selects the update-agent pods, and whether to reset reboot-needed on
+	// nodes which failed to reboot because their update-agent is not running
+	agentPodSelector  labels.Selector
+	agentMissingReset bool
+
+	// time to wait after a reboot completed before allowing another node to
+	// reboot, and the time the last reboot completed
+	rebootCooldown      time.Duration
+	lastRebootCompleted time.Time
+
+	// number of reboots within the flapping window after which a node
+	// wanting to reboot again is excluded, disabled if 0
+	flappingReboots int
+	flappingWindow  time.Duration
+
+	// number of nodes wanting to reboot above which the backlog is reported
+	// once it lasted for the backlog duration, disabled if 0, the time the
+	// backlog first exceeded the threshold, and whether it was reported
+	rebootBacklogThreshold int
+	rebootBacklogDuration  time.Duration
+	backlogSince           time.Time
+	backlogReported        bool
+
+	// number of consecutive failed reboots after which no more nodes are
+	// allowed to reboot, disabled if 0, and the current number of
+	// consecutive failed reboots
+	maxRebootFailures         int
+	consecutiveRebootFailures int
+
+	// log the changes which would be made to nodes instead of making them
+	dryRun bool
+	// reboot strategy of all nodes, never allowing any node to reboot if off
+	rebootStrategy string
+	// annotation of the kube-system namespace and ConfigMap signalling a
+	// cluster upgrade in progress, during which no node may reboot, disabled
+	// if empty, and whether an upgrade was in progress in the last pass
+	upgradeAnnotation         string
+	upgradeConfigMapNamespace string
+	upgradeConfigMapName      string
+	upgrading                 bool
+	// policies applied to nodes by their reboot reason, longest prefix
+	// first, and the policy for the other nodes
+	reasonPolicies      []reasonPolicy
+	defaultReasonPolicy string
+	// leave the nodes which just rebooted alone, for troubleshooting
+	disableCleanup bool
+
+	// limits how often reconciliations run, and the maximum factor of the
+	// reconciliation period added to it as jitter
+	reconcileLimiter flowcontrol.RateLimiter
+	reconcileJitter  float64
+
+	// metrics of the update-operator and the address they are served on,
+	// together with the health and readiness endpoints
+	metricsRegistry *prometheus.Registry
+	listenAddress   string
+	// TLS configuration they are served with, plaintext if nil
+	tlsConfig *tls.Config
+
+	// set to 1 while this operator holds the leader election lock, and once
+	// it has successfully listed the nodes. Accessed atomically.
+	leading     int32
+	nodesListed int32
+
+	// number of node updates made, accessed atomically
+	nodeUpdates uint64
+	// nodes listed during the current reconciliation pass, and the number of
+	// node updates made when they were listed
+	passNodes       *v1api.NodeList
+	passNodeUpdates uint64
+	// number of consecutive reconciliation passes which failed to list the
+	// nodes
+	listFailures int
+
+	// status served by the status endpoint, guarded by statusMu
+	statusMu sync.Mutex
+	status   operatorStatus
+	// why nodes wanting to reboot were not chosen to reboot in the current
+	// pass, keyed by node name, empty for the nodes chosen, and the reason
+	// for the nodes without a reason of their own
+	deferredReasons map[string]string
+	deferredReason  string
+	// requests of the plan endpoint, served by the reconciliation loop
+	planRequests chan chan<- planResult
+	// effective configuration served by the config endpoint
+	config *effectiveConfig
 
 	// Deprecated
 	manageAgent    bool
@@ -113,59 +466,456 @@ type Kontroller struct {
 
 // Config configures a Kontroller.
 type Config struct {
-	// Kubernetesc client
+	// Kubernetes client. Defaults to a client for the cluster the operator is
+	// running in, or for the current context of the kubeconfig.
 	Client kubernetes.Interface
+	// timeout of the requests made with Client, if it was created with one
+	// or by New, so node watches are ended by the apiserver before they time
+	// out
+	ClientTimeout time.Duration
+	// client used for leader election. Defaults to a client for the cluster
+	// the operator is running in.
+	LeaderElectionClient kubernetes.Interface
+	// recorder the events about nodes are recorded with, e.g. a
+	// record.FakeRecorder to inspect them in tests together with a fake
+	// Client and LeaderElectionClient. Defaults to a recorder recording them
+	// with Client, in which case EventNamespace and EventSourceComponent
+	// apply.
+	EventRecorder record.EventRecorder
+	// namespace the operator runs in. Defaults to the POD_NAMESPACE
+	// environment variable.
+	Namespace string
+	// name of the node the operator runs on, rebooted after all other nodes.
+	// Defaults to the NODE_NAME environment variable. Not set if empty.
+	OperatorNode string
 	// migration compatability
 	AutoLabelContainerLinux bool
+	// label selector for the nodes managed by the operator, all nodes if empty
+	NodeSelector string
+	// names of the only nodes managed by the operator, which must also match
+	// the node selector, all nodes if empty
+	Nodes []string
 	// annotations to look for before and after reboots
 	BeforeRebootAnnotations []string
 	AfterRebootAnnotations  []string
+	// label selector for the pods which must be ready on a node after its
+	// reboot, before the reboot is considered successful, in addition to the
+	// after-reboot annotations. Disabled if empty.
+	AfterRebootPodSelector string
+	// period of time a node is left to settle once its after-reboot
+	// annotations are set, before its after-reboot checks continue and its
+	// reboot is considered successful. The node still counts as rebooting
+	// meanwhile. Disabled if 0.
+	PostRebootDelay time.Duration
 	// reboot window
 	RebootWindowStart  string
 	RebootWindowLength string
+	// IANA time zone name the reboot window is interpreted in, e.g.
+	// "Europe/Berlin". Defaults to the local time zone.
+	RebootWindowTimezone string
+	// periods during which no node is allowed to reboot, regardless of the
+	// reboot window, each of the form "start/end", e.g.
+	// "2017-12-22/2018-01-02". Dates are interpreted in the reboot window
+	// timezone, and the end date is included. RFC 3339 times may be given
+	// instead of dates.
+	RebootFreezes []string
+	// name of a RebootPolicy custom resource in the namespace of the
+	// operator whose settings override the reboot window, maximum number of
+	// rebooting nodes, reboot timeout and node selector configured here. It
+	// is reloaded on every reconciliation, and ignored while it does not
+	// exist. Disabled if empty.
+	RebootPolicy string
+	// maximum number of nodes allowed to reboot at the same time
+	MaxRebootingNodes int
+	// maximum number of nodes allowed to reboot at the same time, either
+	// absolute, e.g. "2", or as a percentage of the schedulable nodes, e.g.
+	// "20%". It can not be combined with MaxRebootingNodes.
+	MaxUnavailable string
+	// also reboot nodes whose Ready condition is not True
+	RebootNotReady bool
+	// only reboot the nodes whose update-agent updated them to this
+	// Container Linux version, e.g. "1688.5.3", as set in their new-version
+	// annotation, to canary a release on a subset of the nodes. All nodes if
+	// empty.
+	RebootOSVersion string
+	// order in which nodes wanting to reboot are considered, "name",
+	// "priority", "oldest-first" or "newest-first". Defaults to
+	// "oldest-first".
+	RebootOrder string
+	// reboot all worker nodes before control-plane nodes, never rebooting
+	// both at the same time. The maximum number of rebooting nodes applies
+	// to each separately.
+	SeparateControlPlane bool
+	// label key grouping the nodes into reboot batches by its value, e.g.
+	// "pool". All nodes of a batch wanting to reboot are rebooted, subject to
+	// the other limits, before the nodes of the next batch. Disabled if empty.
+	BatchLabel string
+	// label selector for the nodes hosting etcd members, e.g.
+	// "node-role.kubernetes.io/etcd". At most EtcdMaxConcurrency of them,
+	// default 1, are allowed to reboot at the same time, regardless of the
+	// maximum number of rebooting nodes. Disabled if empty.
+	EtcdNodeSelector   string
+	EtcdMaxConcurrency int
+	// maximum number of nodes in the same zone, as set by the
+	// topology.kubernetes.io/zone label, allowed to reboot at the same time,
+	// in addition to the maximum number of rebooting nodes. Nodes without a
+	// zone are not limited. Unlimited if 0.
+	MaxRebootingNodesPerZone int
+	// minimum number of ready, schedulable nodes which are not rebooting. A
+	// node is not chosen to reboot if this would leave fewer of them.
+	// Disabled if 0.
+	MinReadyNodes int
+	// maximum number of nodes wanting to reboot, in reboot order, which are
+	// evaluated for a reboot in each pass, bounding the requests made by the
+	// checks of each node, e.g. of its pod disruption budgets. Defaults to 50.
+	MaxRebootCandidates int
+	// maximum number of nodes which completed their reboot labeled for, and
+	// released from, the after-reboot checks at once. It does not affect how
+	// many nodes reboot at once. Defaults to 5.
+	CleanupConcurrency int
+	// commands or URLs, run like the reboot hooks, which must all succeed for
+	// a node wanting to reboot to be chosen to reboot, in addition to the
+	// built-in predicates. Nodes failing one are deferred.
+	RebootPredicates []string
+	// time a reboot predicate is given to complete for a node. Defaults to
+	// 30s.
+	RebootPredicateTimeout time.Duration
+	// command run with the node name as argument before a node is allowed to
+	// reboot. The node is not rebooted unless it succeeds.
+	BeforeRebootHook string
+	// command run with the node name as argument after a node has rebooted.
+	// The reboot is only considered successful once it succeeds.
+	AfterRebootHook string
+	// keep nodes whose after-reboot hook fails cordoned and retry the hook,
+	// instead of releasing them
+	AfterRebootHookKeepCordoned bool
+	// time a reboot hook is given to complete
+	RebootHookTimeout time.Duration
+	// drain nodes before allowing them to reboot
+	DrainBeforeReboot bool
+	// "drain", the default, to cordon nodes and evict their pods, or
+	// "cordon-only" to only cordon them, or add the reboot taint, before they
+	// reboot. The cordon-only mode implies DrainBeforeReboot.
+	DrainMode        string
+	DrainGracePeriod time.Duration
+	// period of time during which evictions refused because of a
+	// PodDisruptionBudget are retried. Not retried if 0.
+	DrainTimeout time.Duration
+	// delete the pods which could not be evicted within the drain timeout,
+	// instead of deferring the reboot of their node
+	DrainForce bool
+	// name of the PriorityClass at and above which pods are never evicted.
+	// The reboot of nodes running such pods is deferred. Disabled if empty.
+	ProtectedPriorityClass string
+	// taint, as "key=value" or "key", added to nodes with the NoSchedule
+	// effect before they reboot and removed after, instead of cordoning them
+	// when draining. Disabled if empty.
+	RebootTaint string
+	// time a node is given to complete its reboot after reboot-ok is set
+	RebootTimeout time.Duration
+	// number of times a node which did not complete its reboot within the
+	// reboot timeout is given another reboot timeout before its reboot is
+	// reported as failed
+	RebootMaxRetries int
+	// uptime after which the operator requests a reboot of a node, even
+	// though its update-agent did not, based on the boot-time annotation set
+	// by the update-agent. Disabled if 0.
+	ForceRebootAfter time.Duration
+	// age after which reboot requests of nodes are ignored, based on the
+	// reboot-needed-time annotation set by the update-agent. Requests without
+	// the annotation never expire. Disabled if 0.
+	RebootRequestTTL time.Duration
+	// label selector for the update-agent pods, used to tell whether the
+	// update-agent of a node which failed to reboot is running. Defaults to
+	// "app=container-linux-update-agent".
+	AgentPodSelector string
+	// reset reboot-needed on nodes which failed to reboot while no
+	// update-agent is running on them, so they are not selected again until
+	// their update-agent requests a reboot again
+	AgentMissingReset bool
+	// time to wait after a node completed its reboot before allowing another
+	// node to reboot, giving workloads time to reschedule
+	RebootCooldown time.Duration
+	// number of reboots a node may complete within the flapping window, after
+	// which it is excluded from the operator, with the exclude annotation,
+	// instead of being rebooted again, e.g. because of a runaway update-agent.
+	// Disabled if 0. The flapping window defaults to an hour.
+	FlappingReboots int
+	FlappingWindow  time.Duration
+	// number of consecutive failed reboots, cluster-wide, after which no more
+	// nodes are allowed to reboot until the failures are reset, by annotating
+	// the pause ConfigMap or restarting the operator. Disabled if 0.
+	MaxRebootFailures int
+	// number of nodes wanting to reboot above which a RebootBacklog event is
+	// recorded, once the backlog lasted for RebootBacklogDuration, default
+	// 1h, e.g. because reboots are blocked. Disabled if 0.
+	RebootBacklogThreshold int
+	RebootBacklogDuration  time.Duration
+	// log the changes which would be made to nodes instead of making them
+	DryRun bool
+	// reboot strategy of the operator, either "reboot", the default, or
+	// "off", in which the operator keeps completing the reboots in progress
+	// and reporting the state of the nodes, but never allows a node to
+	// reboot, regardless of the reboot strategy of the node.
+	RebootStrategy string
+	// signals of a cluster upgrade in progress, during which no node is
+	// allowed to reboot: an annotation of the kube-system namespace, and a
+	// ConfigMap given as "namespace/name", set to "true" in its
+	// "upgrade-in-progress" key. Disabled if empty.
+	UpgradeAnnotation string
+	UpgradeConfigMap  string
+	// policies applied to nodes wanting to reboot by their reboot-reason
+	// annotation, each of the form "prefix=policy", where the policy is
+	// "auto" to reboot the node like any node, "approve" to only reboot it
+	// once its reboot is approved, or "defer" to never reboot it. The policy
+	// with the longest prefix of the reason applies, or the default policy,
+	// "auto" if empty, if none does.
+	RebootReasonPolicies      []string
+	RebootReasonDefaultPolicy string
+	// leave the nodes which just rebooted alone, without running their
+	// after-reboot checks or setting reboot-ok=false, so the annotations set
+	// by the update-agent can be observed. For troubleshooting only, as the
+	// nodes never complete their reboot.
+	DisableCleanup bool
+	// maximum rate and burst of reconciliations caused by node changes
+	ReconcileQPS   float32
+	ReconcileBurst int
+	// maximum factor of the reconciliation period randomly added to each
+	// period, so operators started at the same time do not list their nodes
+	// in lockstep. No jitter if 0.
+	ReconcileJitter float64
+	// namespace events are recorded in, instead of the namespace of the
+	// object they are about, and the component they are recorded as
+	EventNamespace       string
+	EventSourceComponent string
+	// also record the RebootStarted, RebootSucceeded, RebootFailed and
+	// RebootDeferred events of nodes on the pod of the operator, named by
+	// the POD_NAME environment variable, or on its leader election lock if
+	// it does not run in a pod
+	MirrorEvents bool
+	// URL the RebootStarted, RebootSucceeded and RebootFailed events are also
+	// posted to as JSON, disabled if empty, and the identifier of the cluster
+	// included in them
+	NotifyWebhookURL string
+	ClusterName      string
+	// URL the result of each completed or failed reboot is posted to as
+	// JSON, retrying failed deliveries, disabled if empty, and the number of
+	// results buffered while they are delivered. Defaults to 100.
+	ResultWebhookURL string
+	ResultQueueSize  int
+	// address to serve metrics and health endpoints on, disabled if empty
+	ListenAddress string
+	// certificate and key files to serve the metrics and health endpoints
+	// with TLS, plaintext if empty, and the file of the CA certificates client
+	// certificates must be signed by, no client authentication if empty
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSClientCAFile string
+	// name and namespace of the leader election lock. The namespace defaults
+	// to the namespace the operator is running in.
+	LeaderElectionName      string
+	LeaderElectionNamespace string
 	// Deprecated
 	ManageAgent    bool
 	AgentImageRepo string
 }
 
-// New initializes a new Kontroller.
+// New initializes a new Kontroller. The label and annotation prefix must be
+// set before, if it is changed.
 func New(config Config) (*Kontroller, error) {
-	// kubernetes client
-	if config.Client == nil {
-		return nil, fmt.Errorf("Kubernetes client must not be nil")
+	if config.ClientTimeout < 0 {
+		return nil, fmt.Errorf("client timeout must not be negative, got %v", config.ClientTimeout)
 	}
 	kc := config.Client
+	if kc == nil {
+		var err error
+		kc, err = k8sutil.GetClientWithTimeout("", "", config.ClientTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create Kubernetes client: %v", err)
+		}
+	}
+	return NewWithClient(kc, WithConfig(config))
+}
+
+// newKontroller initializes a new Kontroller with the given configuration,
+// whose client is set.
+func newKontroller(config Config) (*Kontroller, error) {
+	if err := initSelectors(); err != nil {
+		return nil, fmt.Errorf("Invalid label and annotation keys for prefix %q: %v", constants.Prefix, err)
+	}
 
-	// node interface
-	nc := kc.CoreV1().Nodes()
+	kc := config.Client
+	if config.ClientTimeout < 0 {
+		return nil, fmt.Errorf("client timeout must not be negative, got %v", config.ClientTimeout)
+	}
 
-	// create event emitter
-	broadcaster := record.NewBroadcaster()
-	broadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: kc.CoreV1().Events("")})
-	er := broadcaster.NewRecorder(runtime.NewScheme(), v1api.EventSource{Component: eventSourceComponent})
+	// node interface, recording the requests made with it
+	var nc v1core.NodeInterface = instrumentedNodes{kc.CoreV1().Nodes()}
 
-	leaderElectionClientConfig, err := rest.InClusterConfig()
-	if err != nil {
-		return nil, fmt.Errorf("error creating leader election client config: %v", err)
+	// create event emitter, unless one is given
+	er := config.EventRecorder
+	if er == nil {
+		var sink record.EventSink = &v1core.EventSinkImpl{Interface: kc.CoreV1().Events("")}
+		if config.EventNamespace != "" {
+			sink = &namespacedEventSink{sink: sink, namespace: config.EventNamespace}
+		}
+		component := config.EventSourceComponent
+		if component == "" {
+			component = eventSourceComponent
+		}
+		broadcaster := record.NewBroadcaster()
+		broadcaster.StartRecordingToSink(sink)
+		er = broadcaster.NewRecorder(scheme.Scheme, v1api.EventSource{Component: component})
 	}
-	leaderElectionClient, err := kubernetes.NewForConfig(leaderElectionClientConfig)
-	if err != nil {
-		return nil, fmt.Errorf("error creating leader election client: %v", err)
+
+	leaderElectionClient := config.LeaderElectionClient
+	if leaderElectionClient == nil {
+		leaderElectionClientConfig, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("error creating leader election client config: %v", err)
+		}
+		leaderElectionClient, err = kubernetes.NewForConfig(leaderElectionClientConfig)
+		if err != nil {
+			return nil, fmt.Errorf("error creating leader election client: %v", err)
+		}
 	}
 
 	leaderElectionBroadcaster := record.NewBroadcaster()
 	leaderElectionBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{
-		Interface: v1core.New(leaderElectionClient.Core().RESTClient()).Events(""),
+		Interface: leaderElectionClient.CoreV1().Events(""),
 	})
 	leaderElectionEventRecorder := leaderElectionBroadcaster.NewRecorder(runtime.NewScheme(), v1api.EventSource{
 		Component: leaderElectionEventSourceComponent,
 	})
 
-	namespace := os.Getenv("POD_NAMESPACE")
+	namespace := config.Namespace
+	if namespace == "" {
+		namespace = os.Getenv("POD_NAMESPACE")
+	}
 	if namespace == "" {
 		return nil, fmt.Errorf("unable to determine operator namespace: please ensure POD_NAMESPACE environment variable is set")
 	}
 
+	operatorNode := config.OperatorNode
+	if operatorNode == "" {
+		operatorNode = os.Getenv("NODE_NAME")
+	}
+
+	leaderElectionName := config.LeaderElectionName
+	if leaderElectionName == "" {
+		leaderElectionName = defaultLeaderElectionName
+	}
+	leaderElectionNamespace := config.LeaderElectionNamespace
+	if leaderElectionNamespace == "" {
+		leaderElectionNamespace = namespace
+	}
+
+	// mirror the events before notifying, so each event is only notified
+	// once
+	if config.DryRun {
+		er = dryRunEventRecorder{}
+	} else {
+		if config.MirrorEvents {
+			er = newMirroringEventRecorder(er, namespace, &v1api.ObjectReference{
+				Kind:       "ConfigMap",
+				APIVersion: "v1",
+				Namespace:  leaderElectionNamespace,
+				Name:       leaderElectionName,
+			})
+		}
+		if config.NotifyWebhookURL != "" {
+			er = notifyingEventRecorder{
+				EventRecorder: er,
+				notifier:      notifier.NewWebhook(config.NotifyWebhookURL),
+				cluster:       config.ClusterName,
+			}
+		}
+	}
+
+	// like notifications, results are not posted in dry-run mode
+	var results *notifier.ResultQueue
+	if config.ResultWebhookURL != "" && !config.DryRun {
+		resultQueueSize := config.ResultQueueSize
+		if resultQueueSize == 0 {
+			resultQueueSize = defaultResultQueueSize
+		}
+		if resultQueueSize < 0 {
+			return nil, fmt.Errorf("result queue size must not be negative, got %d", resultQueueSize)
+		}
+		results = notifier.NewResultQueue(config.ResultWebhookURL, resultQueueSize)
+		results.OnDrop = func(r notifier.Result, err error) {
+			logging.With("node", r.Node).Errorf("Dropped the result of the reboot of node %q: %v", r.Node, err)
+		}
+	}
+
+	nodeSelector, err := labels.Parse(config.NodeSelector)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing node selector: %v", err)
+	}
+
+	var nodeNames map[string]bool
+	if len(config.Nodes) > 0 {
+		nodeNames = make(map[string]bool)
+		for _, name := range config.Nodes {
+			if name == "" {
+				return nil, fmt.Errorf("node names must not be empty")
+			}
+			nodeNames[name] = true
+		}
+	}
+
+	agentPodSelectorString := config.AgentPodSelector
+	if agentPodSelectorString == "" {
+		agentPodSelectorString = defaultAgentPodSelector
+	}
+	agentPodSelector, err := labels.Parse(agentPodSelectorString)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing agent pod selector: %v", err)
+	}
+
+	var afterRebootPodSelector labels.Selector
+	if config.AfterRebootPodSelector != "" {
+		afterRebootPodSelector, err = labels.Parse(config.AfterRebootPodSelector)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing after-reboot pod selector: %v", err)
+		}
+	}
+
+	var etcdNodeSelector labels.Selector
+	if config.EtcdNodeSelector != "" {
+		etcdNodeSelector, err = labels.Parse(config.EtcdNodeSelector)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing etcd node selector: %v", err)
+		}
+	}
+	etcdMaxConcurrency := config.EtcdMaxConcurrency
+	if etcdMaxConcurrency == 0 {
+		etcdMaxConcurrency = defaultEtcdMaxConcurrency
+	}
+	if etcdMaxConcurrency < 0 {
+		return nil, fmt.Errorf("etcd max concurrency must be positive, got %d", etcdMaxConcurrency)
+	}
+
+	if config.MaxRebootingNodesPerZone < 0 {
+		return nil, fmt.Errorf("max rebooting nodes per zone must not be negative, got %d", config.MaxRebootingNodesPerZone)
+	}
+
+	maxRebootCandidates := config.MaxRebootCandidates
+	if maxRebootCandidates == 0 {
+		maxRebootCandidates = defaultMaxRebootCandidates
+	}
+	if maxRebootCandidates < 0 {
+		return nil, fmt.Errorf("max reboot candidates must not be negative, got %d", maxRebootCandidates)
+	}
+
+	cleanupConcurrency := config.CleanupConcurrency
+	if cleanupConcurrency == 0 {
+		cleanupConcurrency = defaultCleanupConcurrency
+	}
+	if cleanupConcurrency < 0 {
+		return nil, fmt.Errorf("cleanup concurrency must not be negative, got %d", cleanupConcurrency)
+	}
+
 	var rebootWindow *timeutil.Periodic
 	if config.RebootWindowStart != "" && config.RebootWindowLength != "" {
 		rw, err := timeutil.ParsePeriodic(config.RebootWindowStart, config.RebootWindowLength)
@@ -176,80 +926,485 @@ func New(config Config) (*Kontroller, error) {
 		rebootWindow = rw
 	}
 
-	return &Kontroller{
-		kc: kc,
-		nc: nc,
-		er: er,
+	rebootWindowLocation := time.Local
+	if config.RebootWindowTimezone != "" {
+		loc, err := time.LoadLocation(config.RebootWindowTimezone)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading reboot window timezone: %s", err)
+		}
+		rebootWindowLocation = loc
+	}
+
+	rebootFreezes, err := parseRebootFreezes(config.RebootFreezes, rebootWindowLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	maxRebootingNodes := config.MaxRebootingNodes
+	if maxRebootingNodes == 0 {
+		maxRebootingNodes = defaultMaxRebootingNodes
+	}
+	if maxRebootingNodes < 0 {
+		return nil, fmt.Errorf("maximum number of rebooting nodes must not be negative, got %d", maxRebootingNodes)
+	}
+
+	var maxUnavailable *intstr.IntOrString
+	if config.MaxUnavailable != "" {
+		if config.MaxRebootingNodes != 0 {
+			return nil, fmt.Errorf("maximum number of rebooting nodes and maximum unavailable nodes can not be combined")
+		}
+		mu, err := parseMaxUnavailable(config.MaxUnavailable)
+		if err != nil {
+			return nil, err
+		}
+		maxUnavailable = &mu
+	}
+
+	drainBeforeReboot := config.DrainBeforeReboot
+	drainMode := config.DrainMode
+	switch drainMode {
+	case "":
+		drainMode = drainModeDrain
+	case drainModeDrain:
+	case drainModeCordonOnly:
+		drainBeforeReboot = true
+	default:
+		return nil, fmt.Errorf("unknown drain mode %q, must be %q or %q", drainMode, drainModeDrain, drainModeCordonOnly)
+	}
+
+	drainGracePeriod := config.DrainGracePeriod
+	if drainGracePeriod == 0 {
+		drainGracePeriod = defaultDrainGracePeriod
+	}
+	if drainGracePeriod < 0 {
+		return nil, fmt.Errorf("drain grace period must not be negative, got %v", drainGracePeriod)
+	}
+
+	if config.DrainTimeout < 0 {
+		return nil, fmt.Errorf("drain timeout must not be negative, got %v", config.DrainTimeout)
+	}
+
+	rebootTimeout := config.RebootTimeout
+	if rebootTimeout == 0 {
+		rebootTimeout = defaultRebootTimeout
+	}
+	if rebootTimeout < 0 {
+		return nil, fmt.Errorf("reboot timeout must not be negative, got %v", rebootTimeout)
+	}
+
+	if config.ForceRebootAfter < 0 {
+		return nil, fmt.Errorf("force reboot after must not be negative, got %v", config.ForceRebootAfter)
+	}
+
+	if config.RebootRequestTTL < 0 {
+		return nil, fmt.Errorf("reboot request TTL must not be negative, got %v", config.RebootRequestTTL)
+	}
+
+	if config.PostRebootDelay < 0 {
+		return nil, fmt.Errorf("post-reboot delay must not be negative, got %v", config.PostRebootDelay)
+	}
+
+	if config.FlappingReboots < 0 {
+		return nil, fmt.Errorf("flapping reboots must not be negative, got %d", config.FlappingReboots)
+	}
+	flappingWindow := config.FlappingWindow
+	if flappingWindow == 0 {
+		flappingWindow = defaultFlappingWindow
+	}
+	if flappingWindow < 0 {
+		return nil, fmt.Errorf("flapping window must not be negative, got %v", flappingWindow)
+	}
+
+	if config.RebootCooldown < 0 {
+		return nil, fmt.Errorf("reboot cooldown must not be negative, got %v", config.RebootCooldown)
+	}
+
+	if config.MinReadyNodes < 0 {
+		return nil, fmt.Errorf("minimum number of ready nodes must not be negative, got %d", config.MinReadyNodes)
+	}
+
+	if config.RebootBacklogThreshold < 0 {
+		return nil, fmt.Errorf("reboot backlog threshold must not be negative, got %d", config.RebootBacklogThreshold)
+	}
+	rebootBacklogDuration := config.RebootBacklogDuration
+	if rebootBacklogDuration == 0 {
+		rebootBacklogDuration = defaultRebootBacklogDuration
+	}
+	if rebootBacklogDuration < 0 {
+		return nil, fmt.Errorf("reboot backlog duration must not be negative, got %v", rebootBacklogDuration)
+	}
+
+	if config.MaxRebootFailures < 0 {
+		return nil, fmt.Errorf("maximum number of reboot failures must not be negative, got %d", config.MaxRebootFailures)
+	}
+
+	reconcileQPS := config.ReconcileQPS
+	if reconcileQPS == 0 {
+		reconcileQPS = defaultReconcileQPS
+	}
+	if reconcileQPS < 0 {
+		return nil, fmt.Errorf("reconcile QPS must be positive, got %v", reconcileQPS)
+	}
+
+	reconcileBurst := config.ReconcileBurst
+	if reconcileBurst == 0 {
+		reconcileBurst = defaultReconcileBurst
+	}
+	if reconcileBurst < 0 {
+		return nil, fmt.Errorf("reconcile burst must be positive, got %d", reconcileBurst)
+	}
+
+	if config.ReconcileJitter < 0 {
+		return nil, fmt.Errorf("reconcile jitter must not be negative, got %v", config.ReconcileJitter)
+	}
+
+	rebootTaint, err := parseRebootTaint(config.RebootTaint)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := newTLSConfig(config.TLSCertFile, config.TLSKeyFile, config.TLSClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	rebootOrder, err := parseRebootOrder(config.RebootOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	rebootStrategy, err := parseRebootStrategy(config.RebootStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	upgradeConfigMapNamespace, upgradeConfigMapName, err := parseUpgradeConfigMap(config.UpgradeConfigMap)
+	if err != nil {
+		return nil, err
+	}
+
+	reasonPolicies, err := parseReasonPolicies(config.RebootReasonPolicies)
+	if err != nil {
+		return nil, err
+	}
+	defaultReasonPolicy, err := parseReasonPolicy(config.RebootReasonDefaultPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	rebootHookTimeout := config.RebootHookTimeout
+	if rebootHookTimeout == 0 {
+		rebootHookTimeout = defaultRebootHookTimeout
+	}
+	if rebootHookTimeout < 0 {
+		return nil, fmt.Errorf("reboot hook timeout must not be negative, got %v", rebootHookTimeout)
+	}
+
+	rebootPredicateTimeout := config.RebootPredicateTimeout
+	if rebootPredicateTimeout == 0 {
+		rebootPredicateTimeout = defaultRebootPredicateTimeout
+	}
+	if rebootPredicateTimeout < 0 {
+		return nil, fmt.Errorf("reboot predicate timeout must not be negative, got %v", rebootPredicateTimeout)
+	}
+
+	if config.RebootMaxRetries < 0 {
+		return nil, fmt.Errorf("reboot max retries must not be negative, got %d", config.RebootMaxRetries)
+	}
+
+	k := &Kontroller{
+		kc:                          kc,
+		nc:                          nc,
+		er:                          er,
 		beforeRebootAnnotations:     config.BeforeRebootAnnotations,
 		afterRebootAnnotations:      config.AfterRebootAnnotations,
+		clientTimeout:               config.ClientTimeout,
 		leaderElectionClient:        leaderElectionClient,
 		leaderElectionEventRecorder: leaderElectionEventRecorder,
+		leaderElectionName:          leaderElectionName,
+		leaderElectionNamespace:     leaderElectionNamespace,
 		namespace:                   namespace,
+		operatorNode:                operatorNode,
 		autoLabelContainerLinux:     config.AutoLabelContainerLinux,
+		nodeSelector:                nodeSelector,
+		nodeNames:                   nodeNames,
 		manageAgent:                 config.ManageAgent,
 		agentImageRepo:              config.AgentImageRepo,
 		rebootWindow:                rebootWindow,
-	}, nil
+		rebootWindowLocation:        rebootWindowLocation,
+		rebootFreezes:               rebootFreezes,
+		rebootPolicyName:            config.RebootPolicy,
+		planRequests:                make(chan chan<- planResult),
+		maxRebootingNodes:           maxRebootingNodes,
+		maxUnavailable:              maxUnavailable,
+		rebootNotReady:              config.RebootNotReady,
+		rebootOSVersion:             config.RebootOSVersion,
+		rebootOrder:                 rebootOrder,
+		rebootAttempts:              make(map[string]time.Time),
+		drains:                      make(map[string]*nodeDrain),
+		separateControlPlane:        config.SeparateControlPlane,
+		batchLabel:                  config.BatchLabel,
+		etcdNodeSelector:            etcdNodeSelector,
+		etcdMaxConcurrency:          etcdMaxConcurrency,
+		maxRebootingNodesPerZone:    config.MaxRebootingNodesPerZone,
+		minReadyNodes:               config.MinReadyNodes,
+		maxRebootCandidates:         maxRebootCandidates,
+		cleanupConcurrency:          cleanupConcurrency,
+		results:                     results,
+		clusterName:                 config.ClusterName,
+		rebootPredicateHooks:        config.RebootPredicates,
+		rebootPredicateTimeout:      rebootPredicateTimeout,
+		beforeRebootHook:            config.BeforeRebootHook,
+		afterRebootHook:             config.AfterRebootHook,
+		afterRebootHookKeepCordoned: config.AfterRebootHookKeepCordoned,
+		rebootHookTimeout:           rebootHookTimeout,
+		drainBeforeReboot:           drainBeforeReboot,
+		drainMode:                   drainMode,
+		drainGracePeriod:            drainGracePeriod,
+		drainTimeout:                config.DrainTimeout,
+		drainForce:                  config.DrainForce,
+		protectedPriorityClass:      config.ProtectedPriorityClass,
+		rebootTaint:                 rebootTaint,
+		rebootTimeout:               rebootTimeout,
+		rebootMaxRetries:            config.RebootMaxRetries,
+		forceRebootAfter:            config.ForceRebootAfter,
+		rebootRequestTTL:            config.RebootRequestTTL,
+		expiredRebootRequests:       make(map[string]string),
+		awaitingApprovalReported:    make(map[string]bool),
+		deferralsReported:           make(map[string]string),
+		agentPodSelector:            agentPodSelector,
+		afterRebootPodSelector:      afterRebootPodSelector,
+		postRebootDelay:             config.PostRebootDelay,
+		afterRebootSettle:           make(map[string]time.Time),
+		agentMissingReset:           config.AgentMissingReset,
+		rebootCooldown:              config.RebootCooldown,
+		flappingReboots:             config.FlappingReboots,
+		flappingWindow:              flappingWindow,
+		rebootBacklogThreshold:      config.RebootBacklogThreshold,
+		rebootBacklogDuration:       rebootBacklogDuration,
+		maxRebootFailures:           config.MaxRebootFailures,
+		dryRun:                      config.DryRun,
+		rebootStrategy:              rebootStrategy,
+		upgradeAnnotation:           config.UpgradeAnnotation,
+		upgradeConfigMapNamespace:   upgradeConfigMapNamespace,
+		upgradeConfigMapName:        upgradeConfigMapName,
+		reasonPolicies:              reasonPolicies,
+		defaultReasonPolicy:         defaultReasonPolicy,
+		disableCleanup:              config.DisableCleanup,
+		reconcileLimiter:            flowcontrol.NewTokenBucketRateLimiter(reconcileQPS, reconcileBurst),
+		reconcileJitter:             config.ReconcileJitter,
+		failedReboots:               make(map[string]bool),
+		rebootFailureEvents:         make(map[string]*rebootFailureEvent),
+		rebootRetries:               make(map[string]int),
+		metricsRegistry:             newMetricsRegistry(),
+		listenAddress:               config.ListenAddress,
+		tlsConfig:                   tlsConfig,
+	}
+	k.flagSettings = k.settings()
+	k.config = k.newEffectiveConfig(config)
+	return k, nil
 }
 
 // Run starts the operator reconcilitation proces and runs until the stop
 // channel is closed.
 func (k *Kontroller) Run(stop <-chan struct{}) error {
-	err := k.withLeaderElection()
+	// the goroutines started below are stopped and waited for before
+	// returning, so none of them outlives the operator. stopped is closed
+	// once the stop channel is closed or Run returns.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	done := make(chan struct{})
+	defer close(done)
+	stopped := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-stop:
+		case <-done:
+		}
+		close(stopped)
+	}()
+
+	if k.listenAddress != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			k.serveHTTP(stopped)
+		}()
+	}
+	if k.results != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			k.results.Run(stopped)
+		}()
+	}
+
+	lost, err := k.withLeaderElection(stop)
 	if err != nil {
 		return err
 	}
 
+	// stopped before the lock was acquired
+	select {
+	case <-stop:
+		return nil
+	default:
+	}
+
+	// stop the controller when either the stop channel is closed or the
+	// leader election lock is lost, so no other operator instance races us
+	leading := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-stopped:
+		case <-lost:
+		}
+		close(leading)
+	}()
+
 	// start Container Linux node auto-labeler
 	if k.autoLabelContainerLinux {
-		go wait.Until(k.legacyLabeler, reconciliationPeriod, stop)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.Until(k.legacyLabeler, reconciliationPeriod, leading)
+		}()
 	}
 
 	// Before doing anytihng else, make sure the associated agent daemonset is
 	// ready if it's our responsibility.
-	if k.manageAgent && k.agentImageRepo != "" {
+	if k.manageAgent && k.agentImageRepo != "" && k.dryRun {
+		logging.Info("Dry run: not managing the update-agent daemonset")
+	} else if k.manageAgent && k.agentImageRepo != "" {
 		// create or update the update-agent daemonset
 		err := k.runDaemonsetUpdate(k.agentImageRepo)
 		if err != nil {
-			glog.Errorf("unable to ensure managed agents are ready: %v", err)
+			logging.Errorf("unable to ensure managed agents are ready: %v", err)
 			return err
 		}
 	}
 
-	glog.V(5).Info("starting controller")
+	// resume the reboots allowed by a previous operator, which may have
+	// stopped in the middle of one
+	if err := k.recoverReboots(); err != nil {
+		logging.Errorf("unable to recover reboots in progress: %v", err)
+		return err
+	}
 
-	// call the process loop each period, until stop is closed
-	wait.Until(k.process, reconciliationPeriod, stop)
+	if k.rebootStrategy == constants.RebootStrategyOff {
+		logging.Warningf("Reboot strategy is %q: reboots in progress are completed, but no node is allowed to reboot", k.rebootStrategy)
+	}
 
-	glog.V(5).Info("stopping controller")
-	return nil
+	if k.disableCleanup {
+		logging.Warning("Cleanup disabled: nodes which rebooted keep reboot-ok=true and never complete their reboot")
+	}
+
+	logging.V(5).Info("starting controller")
+
+	// reconcile whenever the state of a node changes, and every period to
+	// catch up on anything the watch missed, until stop is closed or
+	// leadership is lost
+	trigger := make(chan struct{}, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		k.watchNodes(trigger, leading)
+	}()
+	k.reconcileLoop(trigger, leading)
+	// the drains started by the passes are aborted once leading is closed
+	k.drainWG.Wait()
+
+	logging.V(5).Info("stopping controller")
+
+	select {
+	case <-lost:
+		return fmt.Errorf("leader election lost")
+	default:
+		return nil
+	}
 }
 
-// withLeaderElection creates a new context which is cancelled when this
-// operator does not hold a lock to operate on the cluster
-func (k *Kontroller) withLeaderElection() error {
+// reconcileLoop calls the process loop once, then each time a reconciliation
+// is requested on the trigger channel or the reconciliation period passes,
+// until the stop channel is closed. Triggered passes are rate limited. If
+// configured, a random jitter is added to each reconciliation period. While
+// listing the nodes keeps failing, the period is backed off exponentially and
+// triggers are ignored, so a struggling apiserver is not hammered.
+func (k *Kontroller) reconcileLoop(trigger <-chan struct{}, stop <-chan struct{}) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		k.reconcileLimiter.Accept()
+		k.process(stop)
+
+		// restart the period after each pass, as wait.JitterUntil does
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		period := reconciliationPeriod
+		if k.listFailures > 0 {
+			period = listFailureBackoff(k.listFailures)
+			logging.Warningf("Listing nodes failed %d times in a row, retrying in %v", k.listFailures, period)
+		}
+		if k.reconcileJitter > 0 {
+			period = wait.Jitter(period, k.reconcileJitter)
+		}
+		timer.Reset(period)
+
+		// plans are computed between passes, so they never see a pass
+		// half-way through
+		for waiting := true; waiting; {
+			select {
+			case <-stop:
+				return
+			case <-timer.C:
+				waiting = false
+			case <-trigger:
+				// reconciliation triggers are ignored while backing off
+				waiting = k.listFailures > 0
+			case reply := <-k.planRequests:
+				k.servePlan(reply)
+			}
+		}
+	}
+}
+
+// withLeaderElection blocks until this operator holds the lock to operate on
+// the cluster or the stop channel is closed. It returns a channel which is
+// closed when the lock is lost.
+func (k *Kontroller) withLeaderElection(stop <-chan struct{}) (<-chan struct{}, error) {
 	// TODO: a better id might be necessary.
 	// Currently, KVO uses env.POD_NAME and the upstream controller-manager uses this.
 	// Both end up having the same value in general, but Hostname is
 	// more likely to have a value.
 	id, err := os.Hostname()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	resLock := &resourcelock.ConfigMapLock{
 		ConfigMapMeta: v1meta.ObjectMeta{
-			Namespace: k.namespace,
-			Name:      leaderElectionResourceName,
+			Namespace: k.leaderElectionNamespace,
+			Name:      k.leaderElectionName,
 		},
-		Client: k.leaderElectionClient,
+		Client: k.leaderElectionClient.CoreV1(),
 		LockConfig: resourcelock.ResourceLockConfig{
 			Identity:      id,
 			EventRecorder: k.leaderElectionEventRecorder,
 		},
 	}
 
-	waitLeading := make(chan struct{})
+	// buffered so acquiring the lock after a stop does not block
+	waitLeading := make(chan struct{}, 1)
+	lost := make(chan struct{})
 	go func(waitLeading chan<- struct{}) {
 		// Lease values inspired by a combination of
 		// https://github.com/kubernetes/kubernetes/blob/f7c07a121d2afadde7aa15b12a9d02858b30a0a9/pkg/apis/componentconfig/v1alpha1/defaults.go#L163-L174
@@ -263,51 +1418,161 @@ func (k *Kontroller) withLeaderElection() error {
 			RetryPeriod:   leaderElectionLease / 3,
 			Callbacks: leaderelection.LeaderCallbacks{
 				OnStartedLeading: func(stop <-chan struct{}) {
-					glog.V(5).Info("started leading")
+					logging.V(5).Info("started leading")
+					k.setLeading(true)
+					k.recordLeader(id)
 					waitLeading <- struct{}{}
 				},
 				OnStoppedLeading: func() {
-					glog.Fatalf("leaderelection lost")
+					logging.Errorf("leaderelection lost")
+					k.setLeading(false)
+					close(lost)
 				},
 			},
 		})
 	}(waitLeading)
 
-	<-waitLeading
-	return nil
+	select {
+	case <-waitLeading:
+	case <-stop:
+	}
+	return lost, nil
 }
 
-// process performs the reconcilitation to coordinate reboots.
-func (k *Kontroller) process() {
-	glog.V(4).Info("Going through a loop cycle")
+// process performs the reconcilitation to coordinate reboots. Long running
+// steps, such as draining a node, are aborted when the stop channel is closed.
+func (k *Kontroller) process(stop <-chan struct{}) {
+	logging.V(4).Info("Going through a loop cycle")
+
+	// list the nodes again at the start of each pass
+	k.passNodes = nil
+	k.deferredReasons = make(map[string]string)
+	k.deferredReason = ""
+	defer k.recordNodeStatus()
+
+	k.loadRebootPolicy()
+	k.loadMaxRebootingNodesOverride()
+
+	now := time.Now()
+	if k.insideRebootWindow(now) {
+		rebootWindowOpen.Set(1)
+	} else {
+		rebootWindowOpen.Set(0)
+	}
+	k.recordRebootFreeze(k.activeRebootFreeze(now))
 
 	// first make sure that all of our nodes are in a well-defined state with
 	// respect to our annotations and labels, and if they are not, then try to
 	// fix them.
-	glog.V(4).Info("Cleaning up node state")
+	logging.V(4).Info("Cleaning up node state")
 	err := k.cleanupState()
 	if err != nil {
-		glog.Errorf("Failed to cleanup node state: %v", err)
+		logging.Errorf("Failed to cleanup node state: %v", err)
 		return
 	}
 
-	// find nodes with the after-reboot=true label and check if all provided
-	// annotations are set. if all annotations are set to true then remove the
-	// after-reboot=true label and set reboot-ok=false, telling the agent that
-	// the reboot has completed.
-	glog.V(4).Info("Checking if configured after-reboot annotations are set to true")
-	err = k.checkAfterReboot()
+	// abort the reboots the administrator asked to abort, if they have not
+	// started yet.
+	logging.V(4).Info("Aborting reboots annotated to be aborted")
+	err = k.abortReboots()
 	if err != nil {
-		glog.Errorf("Failed to check after reboot: %v", err)
+		logging.Errorf("Failed to abort reboots: %v", err)
 		return
 	}
 
-	// find nodes which just rebooted but haven't run after-reboot checks.
-	// remove after-reboot annotations and add the after-reboot=true label.
-	glog.V(4).Info("Labeling rebooted nodes with after-reboot label")
-	err = k.markAfterReboot()
+	// find nodes which were allowed to reboot but did not complete their
+	// reboot within the reboot timeout, and report them as failed.
+	logging.V(4).Info("Checking for nodes which did not complete their reboot in time")
+	err = k.checkRebootTimeout()
 	if err != nil {
-		glog.Errorf("Failed to update recently rebooted nodes: %v", err)
+		logging.Errorf("Failed to check reboot timeouts: %v", err)
+		return
+	}
+
+	if k.disableCleanup {
+		logging.V(4).Info("Cleanup disabled, leaving nodes which just rebooted alone")
+	} else {
+		// find nodes with the after-reboot=true label and check if all
+		// provided annotations are set. if all annotations are set to true
+		// then remove the after-reboot=true label and set reboot-ok=false,
+		// telling the agent that the reboot has completed.
+		logging.V(4).Info("Checking if configured after-reboot annotations are set to true")
+		err = k.checkAfterReboot(stop)
+		if err != nil {
+			logging.Errorf("Failed to check after reboot: %v", err)
+			return
+		}
+
+		// find nodes which just rebooted but haven't run after-reboot
+		// checks. remove after-reboot annotations and add the
+		// after-reboot=true label.
+		logging.V(4).Info("Labeling rebooted nodes with after-reboot label")
+		err = k.markAfterReboot()
+		if err != nil {
+			logging.Errorf("Failed to update recently rebooted nodes: %v", err)
+			return
+		}
+	}
+
+	// if reboots are paused, do not allow any more nodes to reboot. nodes
+	// which are already rebooting are still completed above.
+	paused, err := k.rebootsPaused()
+	if err != nil {
+		logging.Errorf("Failed to check whether reboots are paused: %v", err)
+		return
+	}
+	if paused {
+		logging.Infof("Reboots are paused by %q in ConfigMap %s/%s, not allowing any node to reboot",
+			pauseConfigMapKey, k.namespace, pauseConfigMapName)
+		k.deferAll("reboots are paused")
+		return
+	}
+
+	// likewise while the cluster is being upgraded, if configured
+	upgrading, err := k.upgradeInProgress()
+	if err != nil {
+		logging.Errorf("Failed to check whether a cluster upgrade is in progress: %v", err)
+		return
+	}
+	if upgrading {
+		logging.V(4).Info("Cluster upgrade in progress, not allowing any node to reboot")
+		k.deferAll("cluster upgrade in progress")
+		return
+	}
+
+	// with the off reboot strategy, the nodes are only observed and never
+	// allowed to reboot.
+	if k.rebootStrategy == constants.RebootStrategyOff {
+		logging.V(4).Infof("Reboot strategy is %q, not allowing any node to reboot", k.rebootStrategy)
+		k.deferAll("reboot strategy of the operator is %q", k.rebootStrategy)
+		if err := k.reportNodesWantingReboot(); err != nil {
+			logging.Errorf("Failed to report nodes wanting to reboot: %v", err)
+		}
+		return
+	}
+
+	// if too many reboots failed in a row, do not allow any more nodes to
+	// reboot until the failures are reset.
+	if k.rebootsHalted() {
+		reset, err := k.resetRebootFailures()
+		if err != nil {
+			logging.Errorf("Failed to check whether reboot failures are reset: %v", err)
+			return
+		}
+		if !reset {
+			logging.Errorf("Reboots are halted after %d consecutive reboot failures, not allowing any node to reboot until annotation %q is set to true on ConfigMap %s/%s",
+				k.consecutiveRebootFailures, constants.Prefix+annotationResetRebootFailures, k.namespace, pauseConfigMapName)
+			k.deferAll("reboots are halted after %d consecutive reboot failures", k.consecutiveRebootFailures)
+			return
+		}
+	}
+
+	// request a reboot of the nodes which have been up for too long, if
+	// configured.
+	logging.V(4).Info("Requesting reboots of nodes which have been up for too long")
+	err = k.markForcedReboots()
+	if err != nil {
+		logging.Errorf("Failed to request forced reboots: %v", err)
 		return
 	}
 
@@ -315,45 +1580,60 @@ func (k *Kontroller) process() {
 	// annotations are set. if all annotations are set to true then remove the
 	// before-reboot=true label and set reboot=ok=true, telling the agent it's
 	// time to reboot.
-	glog.V(4).Info("Checking if configured before-reboot annotations are set to true")
-	err = k.checkBeforeReboot()
+	logging.V(4).Info("Checking if configured before-reboot annotations are set to true")
+	err = k.checkBeforeReboot(stop)
 	if err != nil {
-		glog.Errorf("Failed to check before reboot: %v", err)
+		logging.Errorf("Failed to check before reboot: %v", err)
 		return
 	}
 
 	// take some number of the rebootable nodes. remove before-reboot
 	// annotations and add the before-reboot=true label.
-	glog.V(4).Info("Labeling rebootable nodes with before-reboot label")
-	err = k.markBeforeReboot()
+	logging.V(4).Info("Labeling rebootable nodes with before-reboot label")
+	err = k.markBeforeReboot(stop)
 	if err != nil {
-		glog.Errorf("Failed to update rebootable nodes: %v", err)
+		logging.Errorf("Failed to update rebootable nodes: %v", err)
 		return
 	}
 }
 
+// rebootsPaused returns true if all reboots are paused by the pause ConfigMap
+// of the operator. Reboots are not paused if the ConfigMap does not exist.
+func (k *Kontroller) rebootsPaused() (bool, error) {
+	cm, err := k.kc.CoreV1().ConfigMaps(k.namespace).Get(pauseConfigMapName, v1meta.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed to get ConfigMap %s/%s: %v", k.namespace, pauseConfigMapName, err)
+	}
+	return cm.Data[pauseConfigMapKey] == constants.True, nil
+}
+
 // cleanupState attempts to make sure nodes are in a well-defined state before
-// performing state changes on them.
+// performing state changes on them. The state tracked for nodes which have
+// been deleted or are no longer managed is forgotten.
 // If there is an error getting the list of nodes or updating any of them, an
 // error is immediately returned.
 func (k *Kontroller) cleanupState() error {
-	nodelist, err := k.nc.List(v1meta.ListOptions{})
+	nodelist, err := k.listPassNodes()
 	if err != nil {
 		return fmt.Errorf("Failed listing nodes: %v", err)
 	}
+	k.forgetDeletedNodes(nodelist.Items)
 
 	for _, n := range nodelist.Items {
-		err = k8sutil.UpdateNodeRetry(k.nc, n.Name, func(node *v1api.Node) {
+		// only update nodes which need to be cleaned up. the check is
+		// repeated on the latest version of the node below.
+		if !needsCleanup(&n) {
+			continue
+		}
+		err = k.updateNode(n.Name, func(node *v1api.Node) {
 			// make sure that nodes with the before-reboot label actually
 			// still wants to reboot
-			if _, exists := node.Labels[constants.LabelBeforeReboot]; exists {
-				if !wantsRebootSelector.Matches(fields.Set(node.Annotations)) {
-					glog.Warningf("Node %v no longer wanted to reboot while we were trying to label it so: %v", node.Name, node.Annotations)
-					delete(node.Labels, constants.LabelBeforeReboot)
-					for _, annotation := range k.beforeRebootAnnotations {
-						delete(node.Annotations, annotation)
-					}
-				}
+			if needsCleanup(node) {
+				logging.Warningf("Node %v no longer wanted to reboot while we were trying to label it so: %v", node.Name, node.Annotations)
+				k.releaseBeforeReboot(node)
 			}
 		})
 		if err != nil {
@@ -364,39 +1644,267 @@ func (k *Kontroller) cleanupState() error {
 	return nil
 }
 
+// needsCleanup returns true if the given node is labeled with before-reboot but
+// no longer wants to reboot.
+func needsCleanup(node *v1api.Node) bool {
+	_, exists := node.Labels[constants.LabelBeforeReboot]
+	return exists && !wantsRebootSelector.Matches(fields.Set(node.Annotations))
+}
+
+// releaseBeforeReboot removes the before-reboot label and annotations of the
+// given node, and releases it from its drain, like after a reboot.
+func (k *Kontroller) releaseBeforeReboot(node *v1api.Node) {
+	delete(node.Labels, constants.LabelBeforeReboot)
+	for _, annotation := range k.beforeRebootAnnotations {
+		delete(node.Annotations, annotation)
+	}
+	delete(node.Annotations, constants.AnnotationRebootPhase)
+	uncordonIfCordonedByOperator(node)
+	untaintIfTaintedByOperator(node)
+	enableScaleDownIfDisabledByOperator(node)
+}
+
 // checkBeforeReboot gets all nodes with the before-reboot=true label and checks
 // if all of the configured before-reboot annotations are set to true. If they
 // are, it deletes the before-reboot=true label and sets reboot-ok=true to tell
 // the agent that it is ready to start the actual reboot process.
+// If a before-reboot hook is configured, it is run first. If draining is
+// enabled, the node is then drained in the background, and reboot-ok=true is
+// only set by the pass which finds the drain completed. A node whose hook
+// fails or which fails to drain is skipped and retried on the next loop. The
+// drains of nodes which are no longer in their before-reboot checks are
+// aborted.
 // If it goes to set reboot-ok=true and finds that the node no longer wants a
-// reboot, then it just deletes the before-reboot=true label.
+// reboot, or was excluded, then it deletes the before-reboot=true label and
+// releases the node, and it is left alone if its reboot is being aborted.
 // If there is an error getting the list of nodes or updating any of them, an
 // error is immediately returned.
-func (k *Kontroller) checkBeforeReboot() error {
-	nodelist, err := k.nc.List(v1meta.ListOptions{})
+func (k *Kontroller) checkBeforeReboot(stop <-chan struct{}) error {
+	nodelist, err := k.listPassNodes()
 	if err != nil {
 		return fmt.Errorf("Failed listing nodes: %v", err)
 	}
 
 	preRebootNodes := k8sutil.FilterNodesByRequirement(nodelist.Items, beforeRebootReq)
+	k.cancelDrains(preRebootNodes)
 
 	for _, n := range preRebootNodes {
 		if hasAllAnnotations(n, k.beforeRebootAnnotations) {
-			glog.V(4).Infof("Deleting label %q for %q", constants.LabelBeforeReboot, n.Name)
-			glog.V(4).Infof("Setting annotation %q to true for %q", constants.AnnotationOkToReboot, n.Name)
-			err = k8sutil.UpdateNodeRetry(k.nc, n.Name, func(node *v1api.Node) {
+			started, drained, err := k.drainResult(n.Name)
+			if started && !drained {
+				logging.V(4).Infof("Still draining node %q", n.Name)
+				continue
+			}
+			if started && err != nil {
+				nodeLog(&n).Warningf("Failed to drain node %q, will retry: %v", n.Name, err)
+				continue
+			}
+
+			if !started && k.beforeRebootHook != "" {
+				if err := k.runHook(k.beforeRebootHook, n.Name, stop); err != nil {
+					nodeLog(&n).With("reason", eventReasonBeforeRebootHookFailed).Warningf("Before-reboot hook failed for node %q, will retry: %v", n.Name, err)
+					k.er.Eventf(&n, v1api.EventTypeWarning, eventReasonBeforeRebootHookFailed,
+						"Reboot deferred: before-reboot hook failed: %v", err)
+					continue
+				}
+			}
+
+			if !started && k.drainBeforeReboot {
+				select {
+				case <-stop:
+					return fmt.Errorf("Stopped before draining node %q", n.Name)
+				default:
+				}
+				nodeLog(&n).Infof("Draining node %q before reboot", n.Name)
+				k.startDrain(&n, stop)
+				continue
+			}
+
+			logging.V(4).Infof("Deleting label %q for %q", constants.LabelBeforeReboot, n.Name)
+			logging.V(4).Infof("Setting annotation %q to true for %q", constants.AnnotationOkToReboot, n.Name)
+			allowed := false
+			err = k.updateNode(n.Name, func(node *v1api.Node) {
+				// the node may have changed while it was drained
+				if node.Annotations[constants.AnnotationRebootAbort] == constants.True {
+					return
+				}
+				if !wantsRebootSelector.Matches(fields.Set(node.Annotations)) || node.Annotations[constants.AnnotationExclude] == constants.True {
+					logging.Warningf("Node %v no longer wanted to reboot while we were trying to allow it to: %v", node.Name, node.Annotations)
+					k.releaseBeforeReboot(node)
+					return
+				}
+				allowed = true
 				delete(node.Labels, constants.LabelBeforeReboot)
 				// cleanup the before-reboot annotations
 				for _, annotation := range k.beforeRebootAnnotations {
-					glog.V(4).Info("Deleting annotation %q from node %q", annotation, node.Name)
+					logging.V(4).Infof("Deleting annotation %q from node %q", annotation, node.Name)
 					delete(node.Annotations, annotation)
 				}
+				if k.rebootTaint != nil {
+					taintNode(node, k.rebootTaint)
+				}
 				node.Annotations[constants.AnnotationOkToReboot] = constants.True
+				node.Annotations[constants.AnnotationRebootPhase] = constants.RebootPhaseWaitingForReboot
+				node.Annotations[constants.AnnotationOkToRebootTime] = time.Now().UTC().Format(time.RFC3339)
+				node.Annotations[constants.AnnotationRebootOperatorVersion] = version.Build()
 			})
 			if err != nil {
 				return fmt.Errorf("Failed to update node %q: %v", n.Name, err)
 			}
+			if !allowed {
+				continue
+			}
+			nodeLog(&n).Infof("Node %q allowed to reboot, within %v", n.Name, k.rebootTimeoutOf(&n))
+			if reason := n.Annotations[constants.AnnotationRebootReason]; reason != "" {
+				k.er.Eventf(&n, v1api.EventTypeNormal, eventReasonRebootStarted, "Node allowed to reboot: %s", reason)
+			} else {
+				k.er.Event(&n, v1api.EventTypeNormal, eventReasonRebootStarted, "Node allowed to reboot")
+			}
+		}
+	}
+
+	return nil
+}
+
+// recoverReboots finds nodes which were allowed to reboot by a previous
+// operator, but have no valid reboot-ok-time annotation, e.g. because it was
+// set by an older version of the operator or the annotation was removed. The
+// annotation is set to the current time, so the reboot timeout applies to the
+// node and it cannot be stuck with reboot-ok=true indefinitely. Nodes with a
+// valid annotation are resumed as they are.
+// If there is an error getting the list of nodes or updating any of them, an
+// error is immediately returned.
+func (k *Kontroller) recoverReboots() error {
+	nodelist, err := k.listNodes()
+	if err != nil {
+		return fmt.Errorf("Failed listing nodes: %v", err)
+	}
+
+	okToRebootNodes := k8sutil.FilterNodesByAnnotation(nodelist.Items, okToRebootSelector)
+
+	for i := range okToRebootNodes {
+		n := &okToRebootNodes[i]
+		if _, ok := rebootStartTime(n); ok {
+			nodeLog(n).Infof("Resuming reboot of node %q", n.Name)
+			continue
+		}
+
+		nodeLog(n).Warningf("Node %q was allowed to reboot without recording when, starting its reboot timeout now", n.Name)
+		err = k.updateNode(n.Name, func(node *v1api.Node) {
+			node.Annotations[constants.AnnotationOkToRebootTime] = time.Now().UTC().Format(time.RFC3339)
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to update node %q: %v", n.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkRebootTimeout gets all nodes which the update-operator has allowed to
+// reboot and checks whether they completed their reboot, including the
+// after-reboot checks, within the reboot timeout.
+// The reboot timeout of a node may be overridden by its reboot-timeout
+// annotation.
+// A node which has not rebooted yet is given another reboot timeout up to the
+// configured number of retries. After that, a RebootFailed event is emitted
+// and reboot-ok is reset to false, so the node requests its reboot again.
+// If no update-agent is running on the node, an AgentMissing event is emitted
+// instead, and if configured, reboot-needed is reset to false as well, so the
+// node is not selected again until its update-agent is back.
+// A node which did reboot but is still waiting for its after-reboot checks is
+// left alone, as resetting it would skip the checks, and its failure is only
+// reported once.
+// Failure events of a node are recorded at most once per reboot failure event
+// window, counting the failures in between.
+// Nodes without a valid reboot-ok-time annotation are ignored. The annotation
+// is set on them by recoverReboots when the operator starts.
+// If there is an error getting the list of nodes or updating any of them, an
+// error is immediately returned.
+func (k *Kontroller) checkRebootTimeout() error {
+	nodelist, err := k.listPassNodes()
+	if err != nil {
+		return fmt.Errorf("Failed listing nodes: %v", err)
+	}
+
+	okToRebootNodes := k8sutil.FilterNodesByAnnotation(nodelist.Items, okToRebootSelector)
+
+	for i := range okToRebootNodes {
+		n := &okToRebootNodes[i]
+		started, ok := rebootStartTime(n)
+		if !ok {
+			continue
+		}
+		timeout := k.rebootTimeoutOf(n)
+		// number of reboot timeouts which passed since the node was allowed
+		// to reboot
+		timeouts := int(time.Since(started) / timeout)
+		if timeouts == 0 {
+			continue
+		}
+
+		if justRebootedSelector.Matches(fields.Set(n.Annotations)) {
+			// only report each failed reboot once. nodes left alone on
+			// purpose are not failing.
+			if k.failedReboots[n.Name] || k.disableCleanup {
+				continue
+			}
+			k.failedReboots[n.Name] = true
+			k.rebootFailed(n)
+			nodeLog(n).With("reason", eventReasonRebootFailed).Warningf("Node %q did not complete its after-reboot checks within %v", n.Name, timeout)
+			k.rebootFailureEventf(n, eventReasonRebootFailed,
+				"Timeout waiting for node to complete its reboot: not completed within %v", timeout)
+			continue
+		}
+
+		if timeouts <= k.rebootMaxRetries {
+			if k.rebootRetries[n.Name] < timeouts {
+				k.rebootRetries[n.Name] = timeouts
+				nodeLog(n).Warningf("Node %q did not complete its reboot within %v, waiting again (retry %d of %d)",
+					n.Name, timeout, timeouts, k.rebootMaxRetries)
+			}
+			continue
+		}
+
+		// tell a node whose update-agent is gone apart from a node which is
+		// genuinely slow to reboot
+		agentRunning, err := k.agentRunning(n.Name)
+		if err != nil {
+			return err
+		}
+
+		k.rebootFailed(n)
+		if agentRunning {
+			nodeLog(n).With("reason", eventReasonRebootFailed).Warningf("Node %q did not complete its reboot within %v after %d retries, resetting it", n.Name, timeout, k.rebootMaxRetries)
+			k.rebootFailureEventf(n, eventReasonRebootFailed,
+				"Timeout waiting for node to complete its reboot: not completed within %v after %d retries", timeout, k.rebootMaxRetries)
+		} else {
+			nodeLog(n).With("reason", eventReasonAgentMissing).Warningf("Node %q did not complete its reboot within %v after %d retries and its update-agent is not running, resetting it", n.Name, timeout, k.rebootMaxRetries)
+			k.rebootFailureEventf(n, eventReasonAgentMissing,
+				"Timeout waiting for node to complete its reboot: not completed within %v after %d retries, and no update-agent is running on the node", timeout, k.rebootMaxRetries)
+		}
+		// the update-agent requests its reboot again when it is back
+		clearRebootNeeded := !agentRunning && k.agentMissingReset
+
+		logging.V(4).Infof("Setting annotation %q to false for %q", constants.AnnotationOkToReboot, n.Name)
+		err = k.updateNode(n.Name, func(node *v1api.Node) {
+			if clearRebootNeeded {
+				node.Annotations[constants.AnnotationRebootNeeded] = constants.False
+				node.Labels[constants.LabelRebootNeeded] = constants.False
+				delete(node.Annotations, constants.AnnotationRebootNeededTime)
+			}
+			node.Annotations[constants.AnnotationOkToReboot] = constants.False
+			node.Annotations[constants.AnnotationRebootPhase] = constants.RebootPhaseFailed
+			delete(node.Annotations, constants.AnnotationOkToRebootTime)
+			uncordonIfCordonedByOperator(node)
+			untaintIfTaintedByOperator(node)
+			enableScaleDownIfDisabledByOperator(node)
+			resetApproval(node)
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to update node %q: %v", n.Name, err)
 		}
+		delete(k.rebootRetries, n.Name)
 	}
 
 	return nil
@@ -405,64 +1913,253 @@ func (k *Kontroller) checkBeforeReboot() error {
 // checkAfterReboot gets all nodes with the after-reboot=true label and checks
 // if  all of the configured after-reboot annotations are set to true. If they
 // are, it deletes the after-reboot=true label and sets reboot-ok=false to tell
-// the agent that it has completed it's reboot successfully.
-// If there is an error getting the list of nodes or updating any of them, an
-// error is immediately returned.
-func (k *Kontroller) checkAfterReboot() error {
-	nodelist, err := k.nc.List(v1meta.ListOptions{})
+// the agent that it has completed it's reboot successfully. If the node was
+// cordoned by the update-operator, it is also marked schedulable again.
+// If a post-reboot delay is configured, the node is left to settle for that
+// long once its after-reboot annotations are set, before the checks continue.
+// If an after-reboot pod selector is configured, the selected pods on the node
+// must be ready as well, and if an after-reboot hook is configured, it must
+// succeed. If it fails,
+// the node is kept in the after-reboot checks and the hook is retried on the
+// next loop, or, if configured, the node is released without the reboot being
+// considered successful.
+// The nodes which passed their checks are released concurrently, up to the
+// configured cleanup concurrency at once.
+// If there is an error getting the list of nodes or checking or updating any
+// of them, an error is returned once the other nodes are released.
+func (k *Kontroller) checkAfterReboot(stop <-chan struct{}) error {
+	nodelist, err := k.listPassNodes()
 	if err != nil {
 		return fmt.Errorf("Failed listing nodes: %v", err)
 	}
 
 	postRebootNodes := k8sutil.FilterNodesByRequirement(nodelist.Items, afterRebootReq)
 
+	// the nodes to release, and the after-reboot hook error of each. The
+	// nodes which passed their checks are released even if checking another
+	// node fails, so their hooks are not run again.
+	var released []v1api.Node
+	var hookErrs []error
+	var checkErr error
 	for _, n := range postRebootNodes {
 		if hasAllAnnotations(n, k.afterRebootAnnotations) {
-			glog.V(4).Infof("Deleting label %q for %q", constants.LabelAfterReboot, n.Name)
-			glog.V(4).Infof("Setting annotation %q to false for %q", constants.AnnotationOkToReboot, n.Name)
-			err = k8sutil.UpdateNodeRetry(k.nc, n.Name, func(node *v1api.Node) {
-				delete(node.Labels, constants.LabelAfterReboot)
-				// cleanup the after-reboot annotations
-				for _, annotation := range k.afterRebootAnnotations {
-					glog.V(4).Info("Deleting annotation %q from node %q", annotation, node.Name)
-					delete(node.Annotations, annotation)
-				}
-				node.Annotations[constants.AnnotationOkToReboot] = constants.False
-			})
+			if k.settling(&n) {
+				continue
+			}
+
+			pod, err := k.unreadyAfterRebootPod(n.Name)
 			if err != nil {
-				return fmt.Errorf("Failed to update node %q: %v", n.Name, err)
+				checkErr = err
+				break
+			}
+			if pod != nil {
+				nodeLog(&n).Infof("Waiting for pod %s/%s on node %q to be ready after its reboot", pod.Namespace, pod.Name, n.Name)
+				continue
+			}
+
+			var hookErr error
+			if k.afterRebootHook != "" {
+				hookErr = k.runHook(k.afterRebootHook, n.Name, stop)
+				if hookErr != nil {
+					k.er.Eventf(&n, v1api.EventTypeWarning, eventReasonAfterRebootHookFailed,
+						"After-reboot hook failed: %v", hookErr)
+					if k.afterRebootHookKeepCordoned {
+						nodeLog(&n).With("reason", eventReasonAfterRebootHookFailed).Warningf("After-reboot hook failed for node %q, will retry: %v", n.Name, hookErr)
+						continue
+					}
+					nodeLog(&n).With("reason", eventReasonAfterRebootHookFailed).Warningf("After-reboot hook failed for node %q, releasing it: %v", n.Name, hookErr)
+				}
 			}
+
+			released = append(released, n)
+			hookErrs = append(hookErrs, hookErr)
+		} else {
+			// the node settles once its annotations are set again
+			delete(k.afterRebootSettle, n.Name)
 		}
 	}
 
-	return nil
+	// release the nodes concurrently, so they keep pace when many nodes
+	// complete their reboot at once
+	errs := k.cleanupNodes(released, func(n *v1api.Node) error {
+		logging.V(4).Infof("Deleting label %q for %q", constants.LabelAfterReboot, n.Name)
+		logging.V(4).Infof("Setting annotation %q to false for %q", constants.AnnotationOkToReboot, n.Name)
+		err := k.updateNode(n.Name, func(node *v1api.Node) {
+			delete(node.Labels, constants.LabelAfterReboot)
+			// cleanup the after-reboot annotations
+			for _, annotation := range k.afterRebootAnnotations {
+				logging.V(4).Infof("Deleting annotation %q from node %q", annotation, node.Name)
+				delete(node.Annotations, annotation)
+			}
+			now := time.Now()
+			node.Annotations[constants.AnnotationOkToReboot] = constants.False
+			node.Annotations[constants.AnnotationLastReboot] = now.UTC().Format(time.RFC3339)
+			k.recordRebootCompletion(node, now)
+			delete(node.Annotations, constants.AnnotationOkToRebootTime)
+			delete(node.Annotations, constants.AnnotationRebootPhase)
+			delete(node.Annotations, constants.AnnotationRebootReason)
+			delete(node.Annotations, constants.AnnotationRebootEmergency)
+			uncordonIfCordonedByOperator(node)
+			untaintIfTaintedByOperator(node)
+			enableScaleDownIfDisabledByOperator(node)
+			resetApproval(node)
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to update node %q: %v", n.Name, err)
+		}
+		return nil
+	})
+
+	firstErr := checkErr
+	for i := range released {
+		n := released[i]
+		if errs[i] != nil {
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+
+		delete(k.failedReboots, n.Name)
+		delete(k.rebootRetries, n.Name)
+		delete(k.afterRebootSettle, n.Name)
+		if hookErrs[i] != nil {
+			k.rebootFailed(&n)
+			continue
+		}
+
+		k.rebootSucceeded(&n)
+		delete(k.rebootFailureEvents, n.Name)
+		delete(k.rebootAttempts, n.Name)
+		if started, ok := rebootStartTime(&n); ok {
+			duration := time.Since(started)
+			rebootDurationSeconds.Observe(duration.Seconds())
+			nodeLog(&n).With("reason", eventReasonRebootSucceeded).With("duration", duration.Seconds()).
+				Infof("Node %q completed its reboot in %v", n.Name, duration-duration%time.Second)
+			k.er.Eventf(&n, v1api.EventTypeNormal, eventReasonRebootSucceeded,
+				"Node completed its reboot in %v", duration-duration%time.Second)
+		} else {
+			k.er.Event(&n, v1api.EventTypeNormal, eventReasonRebootSucceeded, "Node completed its reboot")
+		}
+	}
+
+	return firstErr
 }
 
 // markBeforeReboot gets nodes which want to reboot and marks them with the
 // before-reboot=true label. This is considered the beginning of the reboot
 // process from the perspective of the update-operator. It will only mark
 // nodes with this label up to the maximum number of concurrently rebootable
-// nodes as configured with the maxRebootingNodes constant. It also checks if
-// we are inside the reboot window.
+// nodes as configured by the maxRebootingNodes or maxUnavailable field. It
+// also checks if we are inside the reboot window and outside of any reboot
+// freeze, and that the reboot cooldown has passed since the last node
+// completed its reboot. Nodes with an emergency reboot are considered first
+// and bypass these three checks, but no other.
+// Nodes whose reboot request is older than the reboot request TTL, nodes
+// awaiting the approval of their reboot, possibly required by the policy for
+// their reboot reason, nodes deferred by that policy and nodes with the off
+// reboot strategy are never marked, and only one node with
+// the etcd-lock reboot strategy is rebooting at a time. If configured, the
+// number of rebooting nodes hosting etcd members and the number of rebooting
+// nodes in each zone are limited as well. Nodes which are not
+// ready, unless configured otherwise, and nodes whose pods cannot be evicted
+// without violating a PodDisruptionBudget are skipped in favor of the next
+// candidate.
+// Candidates are considered in the configured reboot order, with control-plane
+// nodes last, and at most the configured maximum number of candidates are
+// evaluated. If configured, worker and control-plane nodes reboot in separate
+// phases, each with its own maximum number of rebooting nodes, and only the
+// nodes of the current reboot batch are candidates.
 // It cleans up the before-reboot annotations before it applies the label, in
 // case there are any left over from the last reboot.
 // If there is an error getting the list of nodes or updating any of them, an
 // error is immediately returned.
-func (k *Kontroller) markBeforeReboot() error {
-	nodelist, err := k.nc.List(v1meta.ListOptions{})
+func (k *Kontroller) markBeforeReboot(stop <-chan struct{}) error {
+	nodelist, err := k.listPassNodes()
 	if err != nil {
 		return fmt.Errorf("Failed listing nodes: %v", err)
 	}
 
-	// check if a reboot window is configured
-	if k.rebootWindow != nil {
-		// get previous occurrence relative to now
-		period := k.rebootWindow.Previous(time.Now())
-		// check if we are inside the reboot window
-		if !(period.End.After(time.Now())) {
-			glog.V(4).Info("We are outside the reboot window; not labeling rebootable nodes for now")
-			return nil
+	// find nodes which want to reboot
+	k.forgetDeferrals(nodelist.Items)
+	rebootableNodes := k8sutil.FilterNodesByAnnotation(nodelist.Items, wantsRebootSelector)
+	rebootableNodes = k8sutil.FilterNodesByRequirement(rebootableNodes, notBeforeRebootReq)
+	k.recordRebootBacklog(len(rebootableNodes))
+
+	// nodes with the off reboot strategy are never rebooted
+	var strategyRebootableNodes []v1api.Node
+	for _, n := range rebootableNodes {
+		if rebootStrategy(&n) == constants.RebootStrategyOff {
+			logging.V(4).Infof("Not rebooting node %q: its reboot strategy is %q", n.Name, constants.RebootStrategyOff)
+			k.deferNode(&n, "reboot strategy is %q", constants.RebootStrategyOff)
+			continue
+		}
+		if k.rebootOSVersion != "" && n.Annotations[constants.AnnotationNewVersion] != k.rebootOSVersion {
+			logging.V(4).Infof("Not rebooting node %q: it is not updated to version %q", n.Name, k.rebootOSVersion)
+			k.deferNode(&n, "not updated to version %q", k.rebootOSVersion)
+			continue
+		}
+		if k.rebootRequestExpired(&n) {
+			k.deferNode(&n, "reboot request older than %v", k.rebootRequestTTL)
+			continue
+		}
+		if k.flapping(&n) {
+			if err := k.excludeFlappingNode(&n); err != nil {
+				return err
+			}
+			continue
+		}
+		ok, err := k.applyReasonPolicy(&n)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			k.deferNode(&n, "policy for its reboot reason is %q", reasonPolicyDefer)
+			continue
+		}
+		if k.awaitingApproval(&n) {
+			k.deferNode(&n, "waiting for approval")
+			continue
+		}
+		strategyRebootableNodes = append(strategyRebootableNodes, n)
+	}
+	rebootableNodes = strategyRebootableNodes
+
+	// consider the nodes in a stable order, with control-plane nodes last,
+	// and the nodes chosen to reboot least recently first
+	sortNodes(rebootableNodes, k.leastRecentlyAttempted)
+
+	// nodes with an emergency reboot are considered first, and bypass the
+	// reboot freeze, the reboot window and the reboot cooldown
+	emergencyNodes, scheduledNodes := splitEmergencyNodes(rebootableNodes)
+
+	now := time.Now()
+	if freeze := k.activeRebootFreeze(now); freeze != nil && len(scheduledNodes) > 0 {
+		logging.V(4).Infof("Reboot freeze %s in effect until %v; not labeling rebootable nodes for now", freeze.spec, freeze.end)
+		k.deferNodes(scheduledNodes, "reboot freeze %s", freeze.spec)
+		scheduledNodes = nil
+	}
+
+	if !k.insideRebootWindow(now) {
+		if len(scheduledNodes) > 0 {
+			logging.V(4).Info("We are outside the reboot window; not labeling rebootable nodes for now")
+			k.reportRebootWindowClosed(scheduledNodes, now)
+			k.deferNodes(scheduledNodes, "outside the reboot window")
+			scheduledNodes = nil
 		}
+	} else {
+		k.windowClosedReported = time.Time{}
+	}
+
+	if cooldown := k.rebootCooldown - time.Since(k.lastRebootCompleted); cooldown > 0 && len(scheduledNodes) > 0 {
+		logging.V(4).Infof("A node completed its reboot recently; not labeling rebootable nodes for another %v", cooldown-cooldown%time.Second)
+		k.deferNodes(scheduledNodes, "waiting for the reboot cooldown for another %v", cooldown-cooldown%time.Second)
+		scheduledNodes = nil
+	}
+
+	rebootableNodes = append(emergencyNodes, scheduledNodes...)
+	if len(rebootableNodes) == 0 {
+		return nil
 	}
 
 	// find nodes which are still rebooting
@@ -473,58 +2170,337 @@ func (k *Kontroller) markBeforeReboot() error {
 	afterRebootNodes := k8sutil.FilterNodesByRequirement(nodelist.Items, afterRebootReq)
 	rebootingNodes = append(rebootingNodes, afterRebootNodes...)
 
+	// consider the node the operator runs on after all others
+	rebootableNodes = k.rebootOperatorNodeLast(rebootableNodes)
+
+	// only reboot the nodes of the current batch, if configured
+	allRebootableNodes := rebootableNodes
+	wantingNodes := k8sutil.FilterNodesByRequirement(k8sutil.FilterNodesByAnnotation(nodelist.Items, wantsRebootSelector), notBeforeRebootReq)
+	rebootableNodes = k.rebootBatchNodes(rebootableNodes, wantingNodes, rebootingNodes)
+	for _, n := range allRebootableNodes {
+		if n.Labels[k.batchLabel] != k.batch {
+			k.deferNode(&n, "not in the current reboot batch %s=%q", k.batchLabel, k.batch)
+		}
+	}
+
+	// the nodes the maximum number of rebooting nodes applies to
+	phaseNodes, phaseRebootingNodes := nodelist.Items, rebootingNodes
+	if k.separateControlPlane {
+		var controlPlane bool
+		batchNodes := rebootableNodes
+		phaseNodes, rebootableNodes, phaseRebootingNodes, controlPlane = rebootPhase(nodelist.Items, rebootableNodes, rebootingNodes)
+		if controlPlane {
+			logging.V(4).Info("Rebooting control-plane nodes")
+		} else {
+			logging.V(4).Info("Rebooting worker nodes")
+		}
+		for _, n := range batchNodes {
+			if isControlPlane(&n) != controlPlane {
+				k.deferNode(&n, "waiting for the reboot phase of its role")
+			}
+		}
+	}
+
 	// Verify the number of currently rebooting nodes is less than the the maximum number
-	if len(rebootingNodes) >= maxRebootingNodes {
-		for _, n := range rebootingNodes {
-			glog.Infof("Found node %q still rebooting, waiting", n.Name)
+	// each rebooting node uses its reboot weight of the maximum
+	maxRebootingNodes := k.maxRebootingNodesOf(phaseNodes)
+	rebootingWeight := totalRebootWeight(phaseRebootingNodes)
+	if rebootingWeight >= maxRebootingNodes {
+		for _, n := range phaseRebootingNodes {
+			nodeLog(&n).Infof("Found node %q still rebooting, waiting", n.Name)
 		}
-		glog.Infof("Found %d (of max %d) rebooting nodes; waiting for completion", len(rebootingNodes), maxRebootingNodes)
+		logging.Infof("Found %d (of max %d) rebooting nodes; waiting for completion", rebootingWeight, maxRebootingNodes)
+		k.deferNodes(rebootableNodes, "%d (of max %d) nodes are rebooting", rebootingWeight, maxRebootingNodes)
 		return nil
 	}
 
-	// find nodes which want to reboot
-	rebootableNodes := k8sutil.FilterNodesByAnnotation(nodelist.Items, wantsRebootSelector)
-	rebootableNodes = k8sutil.FilterNodesByRequirement(rebootableNodes, notBeforeRebootReq)
-
 	// Don't even bother if rebootableNodes is empty. We wouldn't do anything anyway.
 	if len(rebootableNodes) == 0 {
 		return nil
 	}
 
-	// find the number of nodes we can tell to reboot
-	remainingRebootableCount := maxRebootingNodes - len(rebootingNodes)
+	// find the weight of the nodes we can tell to reboot
+	remainingRebootableWeight := maxRebootingNodes - rebootingWeight
+
+	pdbs, err := k.listPodDisruptionBudgets()
+	if err != nil {
+		return err
+	}
+	predicates := k.rebootPredicates(pdbs, stop)
+
+	// only one node with the etcd-lock reboot strategy may reboot at a time
+	etcdLockRebooting := false
+	for i := range rebootingNodes {
+		if rebootStrategy(&rebootingNodes[i]) == constants.RebootStrategyEtcdLock {
+			etcdLockRebooting = true
+			break
+		}
+	}
+
+	// only a few nodes hosting etcd members may reboot at a time, so etcd
+	// keeps its quorum
+	etcdRebooting := 0
+	for i := range rebootingNodes {
+		if k.hostsEtcd(&rebootingNodes[i]) {
+			etcdRebooting++
+		}
+	}
+
+	// limit the number of rebooting nodes in each zone, so a failure domain
+	// does not lose several nodes at once
+	zoneRebooting := make(map[string]int)
+	for i := range rebootingNodes {
+		if zone := nodeZone(&rebootingNodes[i]); zone != "" {
+			zoneRebooting[zone]++
+		}
+	}
+
+	// keep at least the minimum number of ready, schedulable nodes which are
+	// not rebooting
+	readyNodes := countReadyNodes(nodelist.Items, rebootingNodes)
+
+	// only one node of each serial reboot group may reboot at a time
+	serialGroupRebooting := make(map[string]bool)
+	for i := range rebootingNodes {
+		if group := rebootingNodes[i].Annotations[constants.AnnotationSerialRebootGroup]; group != "" {
+			serialGroupRebooting[group] = true
+		}
+	}
+
+	// only evaluate the first candidates, so the checks below make a bounded
+	// number of requests in each pass. the next pass starts over from the
+	// first candidates, in reboot order.
+	if len(rebootableNodes) > k.maxRebootCandidates {
+		logging.V(4).Infof("Evaluating %d of %d nodes wanting to reboot", k.maxRebootCandidates, len(rebootableNodes))
+		k.deferNodes(rebootableNodes[k.maxRebootCandidates:], "not among the first %d candidates in reboot order", k.maxRebootCandidates)
+		rebootableNodes = rebootableNodes[:k.maxRebootCandidates]
+	}
 
-	// choose some number of nodes
-	chosenNodes := make([]*v1api.Node, 0, remainingRebootableCount)
-	for i := 0; i < remainingRebootableCount && i < len(rebootableNodes); i++ {
-		chosenNodes = append(chosenNodes, &rebootableNodes[i])
+	// choose some number of nodes, skipping nodes which fail a reboot
+	// predicate, e.g. whose pods cannot be evicted without violating a pod
+	// disruption budget
+	var chosenNodes []*v1api.Node
+	for i := 0; remainingRebootableWeight > 0 && i < len(rebootableNodes); i++ {
+		n := &rebootableNodes[i]
+		// a node heavier than the whole maximum may still reboot alone
+		weight := rebootWeight(n)
+		if weight > remainingRebootableWeight && (rebootingWeight > 0 || len(chosenNodes) > 0) {
+			logging.V(4).Infof("Skipping node %q: its reboot weight %d exceeds the remaining %d", n.Name, weight, remainingRebootableWeight)
+			k.deferNode(n, "its reboot weight %d exceeds the remaining %d (of max %d)", weight, remainingRebootableWeight, maxRebootingNodes)
+			continue
+		}
+		etcdLock := rebootStrategy(n) == constants.RebootStrategyEtcdLock
+		if etcdLock && etcdLockRebooting {
+			nodeLog(n).Infof("Skipping node %q: another node with reboot strategy %q is rebooting", n.Name, constants.RebootStrategyEtcdLock)
+			k.deferNode(n, "another node with reboot strategy %q is rebooting", constants.RebootStrategyEtcdLock)
+			continue
+		}
+		etcd := k.hostsEtcd(n)
+		if etcd && etcdRebooting >= k.etcdMaxConcurrency {
+			nodeLog(n).Infof("Skipping node %q: %d (of max %d) nodes hosting etcd are rebooting", n.Name, etcdRebooting, k.etcdMaxConcurrency)
+			k.deferNode(n, "%d (of max %d) nodes hosting etcd are rebooting", etcdRebooting, k.etcdMaxConcurrency)
+			continue
+		}
+		zone := nodeZone(n)
+		if zone != "" && k.maxRebootingNodesPerZone > 0 && zoneRebooting[zone] >= k.maxRebootingNodesPerZone {
+			nodeLog(n).With("reason", eventReasonRebootDeferred).Infof("Skipping node %q: %d (of max %d) nodes in zone %q are rebooting", n.Name, zoneRebooting[zone], k.maxRebootingNodesPerZone, zone)
+			k.reportDeferral(n, "zone", v1api.EventTypeNormal,
+				"Reboot deferred: %d (of max %d) nodes in zone %q are rebooting", zoneRebooting[zone], k.maxRebootingNodesPerZone, zone)
+			k.deferNode(n, "%d (of max %d) nodes in zone %q are rebooting", zoneRebooting[zone], k.maxRebootingNodesPerZone, zone)
+			continue
+		}
+		ready := availableNode(n)
+		if ready && k.minReadyNodes > 0 && readyNodes-1 < k.minReadyNodes {
+			nodeLog(n).With("reason", eventReasonRebootDeferred).Infof("Skipping node %q: rebooting it would leave %d (of min %d) ready nodes", n.Name, readyNodes-1, k.minReadyNodes)
+			k.reportDeferral(n, "min-ready-nodes", v1api.EventTypeNormal,
+				"Reboot deferred: rebooting this node would leave %d (of min %d) ready nodes", readyNodes-1, k.minReadyNodes)
+			k.deferNode(n, "rebooting it would leave %d (of min %d) ready nodes", readyNodes-1, k.minReadyNodes)
+			continue
+		}
+		serialGroup := n.Annotations[constants.AnnotationSerialRebootGroup]
+		if serialGroup != "" && serialGroupRebooting[serialGroup] {
+			nodeLog(n).With("reason", eventReasonRebootDeferred).Infof("Skipping node %q: another node of serial reboot group %q is rebooting", n.Name, serialGroup)
+			k.deferNode(n, "another node of serial reboot group %q is rebooting", serialGroup)
+			continue
+		}
+		if k.deferOperatorNode(n, len(rebootingNodes), len(chosenNodes)) {
+			continue
+		}
+		deferred := false
+		for _, p := range predicates {
+			reason, err := p.check(n)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				nodeLog(n).With("reason", eventReasonRebootDeferred).Infof("Skipping node %q: predicate %q failed: %s", n.Name, p.name(), reason)
+				k.reportDeferral(n, "predicate "+p.name(), v1api.EventTypeWarning,
+					"Reboot deferred by predicate %q: %s", p.name(), reason)
+				k.deferNode(n, "predicate %q failed: %s", p.name(), reason)
+				deferred = true
+				break
+			}
+		}
+		if deferred {
+			continue
+		}
+		if etcdLock {
+			etcdLockRebooting = true
+		}
+		if etcd {
+			etcdRebooting++
+		}
+		if zone != "" {
+			zoneRebooting[zone]++
+		}
+		if serialGroup != "" {
+			serialGroupRebooting[serialGroup] = true
+		}
+		if ready {
+			readyNodes--
+		}
+		remainingRebootableWeight -= weight
+		chosenNodes = append(chosenNodes, n)
+		k.chooseNode(n)
 	}
+	// the candidates left once enough nodes were chosen
+	k.deferNodes(rebootableNodes, "%d (of max %d) nodes are rebooting", maxRebootingNodes-remainingRebootableWeight, maxRebootingNodes)
 
 	// set before-reboot=true for the chosen nodes
-	glog.Infof("Found %d nodes that need a reboot", len(chosenNodes))
+	logging.Infof("Found %d nodes that need a reboot", len(chosenNodes))
 	for _, n := range chosenNodes {
-		err = k.mark(n.Name, constants.LabelBeforeReboot, k.beforeRebootAnnotations)
+		marked, err := k.mark(n, constants.LabelBeforeReboot, constants.RebootPhaseBeforeRebootChecks, k.beforeRebootAnnotations)
 		if err != nil {
 			return fmt.Errorf("Failed to label node for before reboot checks: %v", err)
 		}
+		if !marked {
+			nodeLog(n).Infof("Node %q changed since it was chosen to reboot, reconsidering it on the next pass", n.Name)
+			continue
+		}
+		k.rebootAttempts[n.Name] = time.Now()
+		if emergencyReboot(n) {
+			k.reportEmergencyReboot(n)
+		}
 		if len(k.beforeRebootAnnotations) > 0 {
-			glog.Infof("Waiting for before-reboot annotations on node %q: %v", n.Name, k.beforeRebootAnnotations)
+			nodeLog(n).Infof("Waiting for before-reboot annotations on node %q: %v", n.Name, k.beforeRebootAnnotations)
 		}
 	}
 
 	return nil
 }
 
+// countReadyNodes returns the number of the given nodes which are available,
+// i.e. ready and schedulable, and not rebooting.
+func countReadyNodes(nodes, rebootingNodes []v1api.Node) int {
+	rebooting := make(map[string]bool)
+	for _, n := range rebootingNodes {
+		rebooting[n.Name] = true
+	}
+	var ready int
+	for i := range nodes {
+		if availableNode(&nodes[i]) && !rebooting[nodes[i].Name] {
+			ready++
+		}
+	}
+	return ready
+}
+
+// availableNode returns true if the given node is ready and schedulable.
+func availableNode(n *v1api.Node) bool {
+	return k8sutil.NodeReady(n) && !n.Spec.Unschedulable
+}
+
+// maxRebootingNodesOf returns the maximum number of the given nodes allowed to
+// reboot at the same time. If the maximum is a percentage, it is computed
+// against the schedulable nodes, including those cordoned to be rebooted,
+// rounding down but allowing at least one node to reboot. A maximum set in
+// the pause ConfigMap takes precedence, lowered to the number of nodes.
+func (k *Kontroller) maxRebootingNodesOf(nodes []v1api.Node) int {
+	if k.maxRebootingNodesOverride > 0 {
+		if k.maxRebootingNodesOverride > len(nodes) && len(nodes) > 0 {
+			return len(nodes)
+		}
+		return k.maxRebootingNodesOverride
+	}
+	if k.maxUnavailable == nil {
+		return k.maxRebootingNodes
+	}
+
+	var schedulable int
+	for _, n := range nodes {
+		if !n.Spec.Unschedulable || n.Annotations[constants.AnnotationCordonedByOperator] == constants.True {
+			schedulable++
+		}
+	}
+
+	// the value was validated in New
+	max, _ := intstr.GetValueFromIntOrPercent(k.maxUnavailable, schedulable, false)
+	if max < 1 {
+		max = 1
+	}
+	return max
+}
+
+// parseMaxUnavailable parses a maximum number of unavailable nodes, which is
+// either a non-negative integer or a percentage.
+func parseMaxUnavailable(s string) (intstr.IntOrString, error) {
+	mu := intstr.Parse(s)
+	if mu.Type == intstr.String && !strings.HasSuffix(mu.StrVal, "%") {
+		return mu, fmt.Errorf("maximum unavailable nodes must be an integer or a percentage, got %q", s)
+	}
+	v, err := intstr.GetValueFromIntOrPercent(&mu, 100, false)
+	if err != nil {
+		return mu, fmt.Errorf("maximum unavailable nodes must be an integer or a percentage, got %q", s)
+	}
+	if v < 0 {
+		return mu, fmt.Errorf("maximum unavailable nodes must not be negative, got %q", s)
+	}
+	return mu, nil
+}
+
+// reportRebootWindowClosed logs and records an event on each of the given
+// nodes wanting to reboot that they are waiting for the reboot window to open,
+// at most once every windowClosedReportPeriod, so a closed reboot window can be
+// told apart from a hung operator.
+func (k *Kontroller) reportRebootWindowClosed(nodes []v1api.Node, now time.Time) {
+	if len(nodes) == 0 || now.Sub(k.windowClosedReported) < windowClosedReportPeriod {
+		return
+	}
+	k.windowClosedReported = now
+
+	opens := k.rebootWindow.Next(now.In(k.rebootWindowLocation)).Start
+	logging.Infof("%d nodes want to reboot, waiting for the reboot window to open at %v", len(nodes), opens)
+	for i := range nodes {
+		k.er.Eventf(&nodes[i], v1api.EventTypeNormal, eventReasonRebootDeferred,
+			"Reboot deferred: outside the reboot window, which opens at %v", opens)
+	}
+}
+
+// insideRebootWindow returns true if the given time is inside the configured
+// reboot window, or if no reboot window is configured.
+func (k *Kontroller) insideRebootWindow(now time.Time) bool {
+	if k.rebootWindow == nil {
+		return true
+	}
+	now = now.In(k.rebootWindowLocation)
+	// get previous occurrence relative to now
+	period := k.rebootWindow.Previous(now)
+	// check if we are inside the reboot window
+	return period.End.After(now)
+}
+
 // markAfterReboot gets nodes which have completed rebooting and marks them with
 // the after-reboot=true label. A node with the after-reboot=true label is still
 // considered to be rebooting from the perspective of the update-operator, even
 // though it has completed rebooting from the machines perspective.
 // It cleans up the after-reboot annotations before it applies the label, in
-// case there are any left over from the last reboot.
-// If there is an error getting the list of nodes or updating any of them, an
-// error is immediately returned.
+// case there are any left over from the last reboot. The nodes are labeled
+// concurrently, up to the configured cleanup concurrency at once.
+// If there is an error getting the list of nodes an error is immediately
+// returned. If there is an error updating any of them, it is returned once
+// the other nodes are labeled.
 func (k *Kontroller) markAfterReboot() error {
-	nodelist, err := k.nc.List(v1meta.ListOptions{})
+	nodelist, err := k.listPassNodes()
 	if err != nil {
 		return fmt.Errorf("Failed listing nodes: %v", err)
 	}
@@ -534,36 +2510,116 @@ func (k *Kontroller) markAfterReboot() error {
 	// also filter out any nodes that are already labeled with after-reboot=true
 	justRebootedNodes = k8sutil.FilterNodesByRequirement(justRebootedNodes, notAfterRebootReq)
 
-	glog.Infof("Found %d rebooted nodes", len(justRebootedNodes))
+	logging.Infof("Found %d rebooted nodes", len(justRebootedNodes))
 
 	// for all the nodes which just rebooted, remove any old annotations and add the after-reboot=true label
-	for _, n := range justRebootedNodes {
-		err = k.mark(n.Name, constants.LabelAfterReboot, k.afterRebootAnnotations)
+	errs := k.cleanupNodes(justRebootedNodes, func(n *v1api.Node) error {
+		marked, err := k.mark(n, constants.LabelAfterReboot, constants.RebootPhaseAfterRebootChecks, k.afterRebootAnnotations)
 		if err != nil {
 			return fmt.Errorf("Failed to label node for after reboot checks: %v", err)
 		}
+		if !marked {
+			nodeLog(n).Infof("Node %q changed since it was found rebooted, reconsidering it on the next pass", n.Name)
+			return nil
+		}
 		if len(k.afterRebootAnnotations) > 0 {
-			glog.Infof("Waiting for after-reboot annotations on node %q: %v", n.Name, k.afterRebootAnnotations)
+			nodeLog(n).Infof("Waiting for after-reboot annotations on node %q: %v", n.Name, k.afterRebootAnnotations)
 		}
-	}
+		return nil
+	})
 
-	return nil
+	return firstError(errs)
 }
 
-func (k *Kontroller) mark(nodeName string, label string, annotations []string) error {
-	glog.V(4).Infof("Deleting annotations %v for %q", annotations, nodeName)
-	glog.V(4).Infof("Setting label %q to %q for node %q", label, constants.True, nodeName)
-	err := k8sutil.UpdateNodeRetry(k.nc, nodeName, func(node *v1api.Node) {
+// mark deletes the given annotations from a node, sets the given label to true
+// and records the given reboot phase on it. The node is only marked if it has
+// not changed since it was listed, otherwise false is returned.
+func (k *Kontroller) mark(n *v1api.Node, label string, phase string, annotations []string) (bool, error) {
+	logging.V(4).Infof("Deleting annotations %v for %q", annotations, n.Name)
+	logging.V(4).Infof("Setting label %q to %q for node %q", label, constants.True, n.Name)
+	marked, err := k.updateListedNode(n, func(node *v1api.Node) {
 		for _, annotation := range annotations {
 			delete(node.Annotations, annotation)
 		}
 		node.Labels[label] = constants.True
+		node.Annotations[constants.AnnotationRebootPhase] = phase
+		disableScaleDown(node)
 	})
 	if err != nil {
-		return fmt.Errorf("Failed to set %q to %q on node %q: %v", label, constants.True, nodeName, err)
+		return false, fmt.Errorf("Failed to set %q to %q on node %q: %v", label, constants.True, n.Name, err)
 	}
 
-	return nil
+	return marked, nil
+}
+
+// listNodes lists the nodes managed by the operator, i.e. the nodes matching
+// the configured node selector, restricted to the configured node names and
+// to the node selector of the RebootPolicy if any. Nodes annotated with
+// exclude=true are left out, so the operator ignores them entirely.
+func (k *Kontroller) listNodes() (*v1api.NodeList, error) {
+	nodelist, err := k.nc.List(v1meta.ListOptions{
+		LabelSelector: k.nodeSelector.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var managed []v1api.Node
+	for _, n := range nodelist.Items {
+		if k.managesNode(n.Name) && (k.policyNodeSelector == nil || k.policyNodeSelector.Matches(labels.Set(n.Labels))) && !excluded(&n) {
+			managed = append(managed, n)
+		}
+	}
+	nodelist.Items = managed
+	atomic.StoreInt32(&k.nodesListed, 1)
+	return nodelist, nil
+}
+
+// excluded returns true if the given node is excluded from all actions of the
+// operator by the administrator.
+func excluded(n *v1api.Node) bool {
+	return n.Annotations[constants.AnnotationExclude] == constants.True
+}
+
+// managesNode returns true if the named node is one of the configured node
+// names, or if no node names are configured. The node selector is not
+// checked.
+func (k *Kontroller) managesNode(name string) bool {
+	return k.nodeNames == nil || k.nodeNames[name]
+}
+
+// listPassNodes lists the managed nodes for the current reconciliation pass.
+// The nodes are listed once per pass, and only listed again after a node has
+// been updated, so each phase of the pass acts on the current state of the
+// nodes. It must only be called from the process loop.
+func (k *Kontroller) listPassNodes() (*v1api.NodeList, error) {
+	updates := atomic.LoadUint64(&k.nodeUpdates)
+	if k.passNodes != nil && k.passNodeUpdates == updates {
+		return k.passNodes, nil
+	}
+
+	nodelist, err := k.listNodes()
+	if err != nil {
+		k.listFailures++
+		return nil, err
+	}
+	k.listFailures = 0
+	k.passNodes = nodelist
+	k.passNodeUpdates = updates
+	return nodelist, nil
+}
+
+// listFailureBackoff returns the period between reconciliations after the
+// given number of consecutive failures to list the nodes, starting from the
+// reconciliation period and doubling after each failure, up to the maximum.
+func listFailureBackoff(failures int) time.Duration {
+	backoff := reconciliationPeriod
+	for i := 1; i < failures && backoff < maxListFailureBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxListFailureBackoff {
+		backoff = maxListFailureBackoff
+	}
+	return backoff
 }
 
 func hasAllAnnotations(node v1api.Node, annotations []string) bool {
@@ -576,3 +2632,43 @@ func hasAllAnnotations(node v1api.Node, annotations []string) bool {
 	}
 	return true
 }
+
+// rebootStartTime returns the time at which the update-operator allowed the
+// node to reboot, as recorded in the reboot-ok-time annotation. The second
+// return value is false if the annotation is missing or invalid.
+func rebootStartTime(node *v1api.Node) (time.Time, bool) {
+	return annotationTime(node, constants.AnnotationOkToRebootTime)
+}
+
+// rebootRequestTime returns the time at which the update-agent requested the
+// node to reboot, as recorded in the reboot-needed-time annotation. The
+// second return value is false if the annotation is missing or invalid.
+func rebootRequestTime(node *v1api.Node) (time.Time, bool) {
+	return annotationTime(node, constants.AnnotationRebootNeededTime)
+}
+
+// annotationTime returns the RFC3339 time in the given annotation of a node.
+// The second return value is false if the annotation is missing or invalid.
+func annotationTime(node *v1api.Node, key string) (time.Time, bool) {
+	value, ok := node.Annotations[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		logging.Warningf("Node %q has an invalid %q annotation %q: %v", node.Name, key, value, err)
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// nodeLog returns a logger with the name and, if set, the reboot phase of the
+// given node as fields, so logs about a node can be correlated in structured
+// log formats.
+func nodeLog(node *v1api.Node) logging.Logger {
+	l := logging.With("node", node.Name)
+	if phase, ok := node.Annotations[constants.AnnotationRebootPhase]; ok {
+		l = l.With("phase", phase)
+	}
+	return l
+}
@@ -0,0 +1,60 @@
+package operator
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+// Option configures a Kontroller created by NewWithClient. Options are
+// applied in order, so an option overrides the settings of the options before
+// it.
+type Option func(*Config)
+
+// WithConfig configures the Kontroller with the given configuration. Its
+// client is ignored in favor of the one given to NewWithClient.
+func WithConfig(config Config) Option {
+	return func(c *Config) {
+		*c = config
+	}
+}
+
+// WithLeaderElectionClient sets the client used for leader election, e.g. the
+// fake clientset given to NewWithClient in tests.
+func WithLeaderElectionClient(kc kubernetes.Interface) Option {
+	return func(c *Config) {
+		c.LeaderElectionClient = kc
+	}
+}
+
+// WithEventRecorder sets the recorder the events about nodes are recorded
+// with, e.g. a record.FakeRecorder.
+func WithEventRecorder(er record.EventRecorder) Option {
+	return func(c *Config) {
+		c.EventRecorder = er
+	}
+}
+
+// WithNamespace sets the namespace the operator runs in.
+func WithNamespace(namespace string) Option {
+	return func(c *Config) {
+		c.Namespace = namespace
+	}
+}
+
+// NewWithClient initializes a new Kontroller managing the nodes of the cluster
+// of the given client, configured by the given options. Tests can give a
+// fake.NewSimpleClientset with the nodes they start from, and inspect the
+// nodes and events after running the Kontroller.
+func NewWithClient(kc kubernetes.Interface, opts ...Option) (*Kontroller, error) {
+	if kc == nil {
+		return nil, fmt.Errorf("Kubernetes client must not be nil")
+	}
+	var config Config
+	for _, opt := range opts {
+		opt(&config)
+	}
+	config.Client = kc
+	return newKontroller(config)
+}
@@ -0,0 +1,166 @@
+package operator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	v1api "k8s.io/api/core/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+)
+
+const (
+	// orders in which nodes wanting to reboot are considered
+	rebootOrderName     = "name"
+	rebootOrderPriority = "priority"
+	// by the time the reboot was requested, first come, first served, or
+	// the most recently requested first
+	rebootOrderOldestFirst = "oldest-first"
+	rebootOrderNewestFirst = "newest-first"
+
+	// role labels of control-plane nodes
+	labelMasterRole       = "node-role.kubernetes.io/master"
+	labelControlPlaneRole = "node-role.kubernetes.io/control-plane"
+)
+
+// nodeLess reports whether node a should reboot before node b.
+type nodeLess func(a, b *v1api.Node) bool
+
+// rebootOrders are the supported reboot orders.
+var rebootOrders = map[string]nodeLess{
+	rebootOrderName:        byName,
+	rebootOrderPriority:    byPriority,
+	rebootOrderOldestFirst: byRequestTime(false),
+	rebootOrderNewestFirst: byRequestTime(true),
+}
+
+// parseRebootOrder returns the comparator of the named reboot order. The
+// oldest-first order is used if the name is empty.
+func parseRebootOrder(name string) (nodeLess, error) {
+	if name == "" {
+		name = rebootOrderOldestFirst
+	}
+	less, ok := rebootOrders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown reboot order %q, must be %q, %q, %q or %q", name, rebootOrderName, rebootOrderPriority, rebootOrderOldestFirst, rebootOrderNewestFirst)
+	}
+	return less, nil
+}
+
+// byName orders nodes by their name.
+func byName(a, b *v1api.Node) bool {
+	return a.Name < b.Name
+}
+
+// byPriority orders nodes by the value of their reboot-priority annotation,
+// highest first. Nodes without a valid priority have priority 0. Nodes with
+// the same priority are ordered by name.
+func byPriority(a, b *v1api.Node) bool {
+	pa, pb := rebootPriority(a), rebootPriority(b)
+	if pa != pb {
+		return pa > pb
+	}
+	return byName(a, b)
+}
+
+// byRequestTime orders nodes by the time their reboot was requested, in their
+// reboot-needed-time annotation, oldest first, or newest first if newest is
+// true. Nodes without a valid request time come last. Nodes requesting their
+// reboot at the same time are ordered by name.
+func byRequestTime(newest bool) nodeLess {
+	return func(a, b *v1api.Node) bool {
+		ta, oka := requestTime(a)
+		tb, okb := requestTime(b)
+		if oka != okb {
+			return oka
+		}
+		if !ta.Equal(tb) {
+			return ta.Before(tb) != newest
+		}
+		return byName(a, b)
+	}
+}
+
+// requestTime returns the time the reboot of the given node was requested,
+// like rebootRequestTime, without reporting invalid annotations, as nodes are
+// compared many times when sorted.
+func requestTime(n *v1api.Node) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, n.Annotations[constants.AnnotationRebootNeededTime])
+	return t, err == nil
+}
+
+func rebootPriority(n *v1api.Node) int {
+	p, err := strconv.Atoi(n.Annotations[constants.AnnotationRebootPriority])
+	if err != nil {
+		return 0
+	}
+	return p
+}
+
+// isControlPlane returns true if the node has the master or control-plane role
+// label.
+func isControlPlane(n *v1api.Node) bool {
+	_, master := n.Labels[labelMasterRole]
+	_, controlPlane := n.Labels[labelControlPlaneRole]
+	return master || controlPlane
+}
+
+// splitControlPlane splits the given nodes into worker and control-plane nodes.
+func splitControlPlane(nodes []v1api.Node) (workers, controlPlane []v1api.Node) {
+	for _, n := range nodes {
+		if isControlPlane(&n) {
+			controlPlane = append(controlPlane, n)
+		} else {
+			workers = append(workers, n)
+		}
+	}
+	return workers, controlPlane
+}
+
+// rebootPhase returns the nodes of the reboot phase in progress when worker
+// and control-plane nodes reboot in separate phases, along with those of them
+// which want to reboot and those which are rebooting. All workers reboot
+// before the control-plane nodes, and no worker and control-plane node reboot
+// at the same time.
+func rebootPhase(nodes, rebootable, rebooting []v1api.Node) (phase, phaseRebootable, phaseRebooting []v1api.Node, controlPlane bool) {
+	workers, controlPlaneNodes := splitControlPlane(nodes)
+	rebootableWorkers, rebootableControlPlane := splitControlPlane(rebootable)
+	rebootingWorkers, rebootingControlPlane := splitControlPlane(rebooting)
+
+	switch {
+	case len(rebootingWorkers) > 0 && len(rebootingControlPlane) > 0:
+		// both are rebooting already, wait for them before starting more
+		return workers, nil, rebootingWorkers, false
+	case len(rebootingControlPlane) > 0:
+		return controlPlaneNodes, rebootableControlPlane, rebootingControlPlane, true
+	case len(rebootingWorkers) > 0 || len(rebootableWorkers) > 0:
+		return workers, rebootableWorkers, rebootingWorkers, false
+	default:
+		return controlPlaneNodes, rebootableControlPlane, rebootingControlPlane, true
+	}
+}
+
+// leastRecentlyAttempted reports whether node a was chosen to reboot less
+// recently than node b, nodes never chosen first. Nodes chosen at the same
+// time, or never, are ordered by the reboot order.
+func (k *Kontroller) leastRecentlyAttempted(a, b *v1api.Node) bool {
+	ta, tb := k.rebootAttempts[a.Name], k.rebootAttempts[b.Name]
+	if !ta.Equal(tb) {
+		return ta.Before(tb)
+	}
+	return k.rebootOrder(a, b)
+}
+
+// sortNodes sorts the given nodes in the order they should reboot, according
+// to less. Control-plane nodes are always ordered after all other nodes.
+func sortNodes(nodes []v1api.Node, less nodeLess) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := &nodes[i], &nodes[j]
+		if ca, cb := isControlPlane(a), isControlPlane(b); ca != cb {
+			return cb
+		}
+		return less(a, b)
+	})
+}
@@ -0,0 +1,64 @@
+package operator
+
+import (
+	"fmt"
+
+	v1api "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/coreos/container-linux-update-operator/pkg/drain"
+)
+
+// listPodDisruptionBudgets returns the PodDisruptionBudgets in all namespaces.
+func (k *Kontroller) listPodDisruptionBudgets() ([]policy.PodDisruptionBudget, error) {
+	pdbList, err := k.kc.PolicyV1beta1().PodDisruptionBudgets(v1api.NamespaceAll).List(v1meta.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed listing pod disruption budgets: %v", err)
+	}
+	return pdbList.Items, nil
+}
+
+// blockingPodDisruptionBudget returns the first PodDisruptionBudget in pdbs
+// that would be violated by evicting the pods on the given node, or nil if the
+// pods of the node may all be evicted.
+//
+// Pods on the node are mapped to each budget selecting them, and a budget is
+// violated if more of its pods run on the node than it currently allows to be
+// disrupted.
+func (k *Kontroller) blockingPodDisruptionBudget(n *v1api.Node, pdbs []policy.PodDisruptionBudget) (*policy.PodDisruptionBudget, error) {
+	if len(pdbs) == 0 {
+		return nil, nil
+	}
+
+	pods, err := drain.GetPodsForDeletion(k.kc, n.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get list of pods on node %q: %v", n.Name, err)
+	}
+
+	for i := range pdbs {
+		pdb := &pdbs[i]
+		// a budget without a selector does not select any pods
+		if pdb.Spec.Selector == nil || len(pdb.Spec.Selector.MatchLabels)+len(pdb.Spec.Selector.MatchExpressions) == 0 {
+			continue
+		}
+		selector, err := v1meta.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector in pod disruption budget %s/%s: %v", pdb.Namespace, pdb.Name, err)
+		}
+
+		var selected int32
+		for _, pod := range pods {
+			if pod.Namespace == pdb.Namespace && selector.Matches(labels.Set(pod.Labels)) {
+				selected++
+			}
+		}
+
+		if selected > pdb.Status.PodDisruptionsAllowed {
+			return pdb, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,343 @@
+package operator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	v1api "k8s.io/api/core/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+	"github.com/coreos/container-linux-update-operator/pkg/k8sutil"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+const (
+	// planTimeout is how long the plan endpoint waits for the reconciliation
+	// loop to compute a plan.
+	planTimeout = 30 * time.Second
+)
+
+// rebootPlan is the order in which the nodes wanting to reboot would be
+// rebooted, as served by the plan endpoint.
+type rebootPlan struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	// whether the reboot window is open now, and when it opens next if not
+	RebootWindowOpen  bool       `json:"rebootWindowOpen"`
+	RebootWindowOpens *time.Time `json:"rebootWindowOpens,omitempty"`
+	// names of the nodes being rebooted, which the first wave waits for
+	Rebooting []string `json:"rebooting"`
+	// the nodes which would reboot together, one wave after the other, each
+	// wave starting once the previous one completed
+	Waves [][]plannedNode `json:"waves"`
+	// nodes wanting to reboot which would not be rebooted, and why
+	Skipped []skippedNode `json:"skipped"`
+}
+
+// plannedNode is a node in a wave of the reboot plan.
+type plannedNode struct {
+	Name   string `json:"name"`
+	Zone   string `json:"zone,omitempty"`
+	Batch  string `json:"batch,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// skippedNode is a node wanting to reboot which is left out of the plan.
+type skippedNode struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// plan computes the order in which the nodes wanting to reboot would be
+// rebooted by markBeforeReboot, without changing anything: nodes are filtered,
+// ordered, grouped into batches and phases, and checked against the built-in
+// reboot predicates as in markBeforeReboot, then split into waves respecting
+// the maximum number of rebooting nodes and the etcd, zone, serial reboot group
+// and minimum ready nodes limits. The reboot predicate hooks are not run, and
+// the PodDisruptionBudgets are checked against the current state of the
+// cluster only. It must only be called from the reconciliation loop.
+func (k *Kontroller) plan() (*rebootPlan, error) {
+	nodelist, err := k.listNodes()
+	if err != nil {
+		return nil, fmt.Errorf("Failed listing nodes: %v", err)
+	}
+
+	now := time.Now()
+	p := &rebootPlan{
+		GeneratedAt:      now.UTC(),
+		RebootWindowOpen: k.insideRebootWindow(now),
+		Rebooting:        []string{},
+		Waves:            [][]plannedNode{},
+		Skipped:          []skippedNode{},
+	}
+	if !p.RebootWindowOpen {
+		opens := k.rebootWindow.Next(now.In(k.rebootWindowLocation)).Start.UTC()
+		p.RebootWindowOpens = &opens
+	}
+
+	rebootingNodes := k8sutil.FilterNodesByAnnotation(nodelist.Items, stillRebootingSelector)
+	rebootingNodes = append(rebootingNodes, k8sutil.FilterNodesByRequirement(nodelist.Items, beforeRebootReq)...)
+	rebootingNodes = append(rebootingNodes, k8sutil.FilterNodesByRequirement(nodelist.Items, afterRebootReq)...)
+	seen := make(map[string]bool)
+	for _, n := range rebootingNodes {
+		if !seen[n.Name] {
+			seen[n.Name] = true
+			p.Rebooting = append(p.Rebooting, n.Name)
+		}
+	}
+
+	pdbs, err := k.listPodDisruptionBudgets()
+	if err != nil {
+		return nil, err
+	}
+	var predicates []rebootPredicate
+	for _, pr := range k.rebootPredicates(pdbs, nil) {
+		if _, ok := pr.(hookPredicate); !ok {
+			predicates = append(predicates, pr)
+		}
+	}
+
+	wanting := k8sutil.FilterNodesByAnnotation(nodelist.Items, wantsRebootSelector)
+	wanting = k8sutil.FilterNodesByRequirement(wanting, notBeforeRebootReq)
+	var candidates []v1api.Node
+	for i := range wanting {
+		n := &wanting[i]
+		reason, err := k.planSkipReason(n, predicates)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			p.Skipped = append(p.Skipped, skippedNode{Name: n.Name, Reason: reason})
+			continue
+		}
+		candidates = append(candidates, *n)
+	}
+	sortNodes(candidates, k.leastRecentlyAttempted)
+	candidates, operatorNode := k.splitOperatorNode(candidates)
+
+	// nodes of different batches and phases never reboot in the same wave.
+	// the current batch comes first, then the others in reboot order.
+	var groups [][]v1api.Node
+	groupIndex := make(map[string]int)
+	if k.batchActive {
+		groupIndex[k.batch] = 0
+		groups = append(groups, nil)
+	}
+	for _, n := range candidates {
+		key := n.Labels[k.batchLabel]
+		i, ok := groupIndex[key]
+		if !ok {
+			i = len(groups)
+			groupIndex[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], n)
+	}
+	if k.separateControlPlane {
+		var phased [][]v1api.Node
+		var controlPlane []v1api.Node
+		for _, g := range groups {
+			workers, cp := splitControlPlane(g)
+			phased = append(phased, workers)
+			controlPlane = append(controlPlane, cp...)
+		}
+		groups = append(phased, controlPlane)
+	}
+	// the node the operator runs on reboots alone, after all others
+	if operatorNode != nil {
+		groups = append(groups, []v1api.Node{*operatorNode})
+	}
+
+	first := true
+	for _, g := range groups {
+		remaining := g
+		for len(remaining) > 0 {
+			var rebooting []v1api.Node
+			if first {
+				rebooting = rebootingNodes
+			}
+			wave, rest := k.planWave(nodelist.Items, remaining, rebooting)
+			first = false
+			if len(wave) == 0 {
+				if len(rebooting) > 0 {
+					// wait for the nodes rebooting now
+					continue
+				}
+				for _, n := range rest {
+					p.Skipped = append(p.Skipped, skippedNode{Name: n.Name, Reason: "would leave too few ready nodes"})
+				}
+				break
+			}
+			p.Waves = append(p.Waves, wave)
+			remaining = rest
+		}
+	}
+	return p, nil
+}
+
+// planSkipReason returns why the given node wanting to reboot would not be
+// chosen to reboot regardless of the other nodes, or an empty reason if it
+// may be.
+func (k *Kontroller) planSkipReason(n *v1api.Node, predicates []rebootPredicate) (string, error) {
+	if rebootStrategy(n) == constants.RebootStrategyOff {
+		return fmt.Sprintf("reboot strategy is %q", constants.RebootStrategyOff), nil
+	}
+	if k.rebootOSVersion != "" && n.Annotations[constants.AnnotationNewVersion] != k.rebootOSVersion {
+		return fmt.Sprintf("not updated to version %q", k.rebootOSVersion), nil
+	}
+	if requested, ok := rebootRequestTime(n); ok && k.rebootRequestTTL > 0 && time.Since(requested) > k.rebootRequestTTL {
+		return fmt.Sprintf("reboot request older than %v", k.rebootRequestTTL), nil
+	}
+	if k.flapping(n) {
+		return fmt.Sprintf("rebooted more than %d times within %v, would be excluded", k.flappingReboots, k.flappingWindow), nil
+	}
+	switch k.rebootReasonPolicy(n) {
+	case reasonPolicyDefer:
+		return fmt.Sprintf("policy for its reboot reason is %q", reasonPolicyDefer), nil
+	case reasonPolicyApprove:
+		if _, ok := n.Annotations[constants.AnnotationRebootApproval]; !ok {
+			return "waiting for approval", nil
+		}
+	}
+	if n.Annotations[constants.AnnotationRebootApproval] == constants.RebootApprovalRequired {
+		return "waiting for approval", nil
+	}
+	for _, p := range predicates {
+		reason, err := p.check(n)
+		if err != nil {
+			return "", err
+		}
+		if reason != "" {
+			return fmt.Sprintf("predicate %q failed: %s", p.name(), reason), nil
+		}
+	}
+	return "", nil
+}
+
+// planWave returns the next wave of the given candidates, in reboot order,
+// while the given nodes are rebooting, and the candidates left for the next
+// waves.
+func (k *Kontroller) planWave(nodes, candidates, rebootingNodes []v1api.Node) ([]plannedNode, []v1api.Node) {
+	phase := nodes
+	if k.separateControlPlane && len(candidates) > 0 {
+		workers, controlPlane := splitControlPlane(nodes)
+		phase = workers
+		if isControlPlane(&candidates[0]) {
+			phase = controlPlane
+		}
+	}
+	rebootingWeight := totalRebootWeight(rebootingNodes)
+	capacity := k.maxRebootingNodesOf(phase) - rebootingWeight
+
+	etcdLockRebooting := false
+	etcdRebooting := 0
+	zoneRebooting := make(map[string]int)
+	serialGroupRebooting := make(map[string]bool)
+	for i := range rebootingNodes {
+		n := &rebootingNodes[i]
+		if rebootStrategy(n) == constants.RebootStrategyEtcdLock {
+			etcdLockRebooting = true
+		}
+		if k.hostsEtcd(n) {
+			etcdRebooting++
+		}
+		if zone := nodeZone(n); zone != "" {
+			zoneRebooting[zone]++
+		}
+		if group := n.Annotations[constants.AnnotationSerialRebootGroup]; group != "" {
+			serialGroupRebooting[group] = true
+		}
+	}
+	readyNodes := countReadyNodes(nodes, rebootingNodes)
+
+	var wave []plannedNode
+	var rest []v1api.Node
+	for i := range candidates {
+		n := &candidates[i]
+		etcdLock := rebootStrategy(n) == constants.RebootStrategyEtcdLock
+		etcd := k.hostsEtcd(n)
+		zone := nodeZone(n)
+		ready := availableNode(n)
+		serialGroup := n.Annotations[constants.AnnotationSerialRebootGroup]
+		weight := rebootWeight(n)
+		if capacity <= 0 ||
+			(weight > capacity && (rebootingWeight > 0 || len(wave) > 0)) ||
+			(etcdLock && etcdLockRebooting) ||
+			(etcd && etcdRebooting >= k.etcdMaxConcurrency) ||
+			(zone != "" && k.maxRebootingNodesPerZone > 0 && zoneRebooting[zone] >= k.maxRebootingNodesPerZone) ||
+			(ready && k.minReadyNodes > 0 && readyNodes-1 < k.minReadyNodes) ||
+			(serialGroup != "" && serialGroupRebooting[serialGroup]) {
+			rest = append(rest, *n)
+			continue
+		}
+
+		if etcdLock {
+			etcdLockRebooting = true
+		}
+		if etcd {
+			etcdRebooting++
+		}
+		if zone != "" {
+			zoneRebooting[zone]++
+		}
+		if serialGroup != "" {
+			serialGroupRebooting[serialGroup] = true
+		}
+		if ready {
+			readyNodes--
+		}
+		capacity -= weight
+		planned := plannedNode{
+			Name:   n.Name,
+			Zone:   zone,
+			Reason: n.Annotations[constants.AnnotationRebootReason],
+		}
+		if k.batchLabel != "" {
+			planned.Batch = n.Labels[k.batchLabel]
+		}
+		wave = append(wave, planned)
+	}
+	return wave, rest
+}
+
+// planHandler serves the reboot plan computed by the reconciliation loop as
+// JSON. Only the leader runs the reconciliation loop, so other operators
+// respond with 503 Service Unavailable.
+func (k *Kontroller) planHandler(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&k.leading) == 0 {
+		http.Error(w, "Not the leader", http.StatusServiceUnavailable)
+		return
+	}
+
+	reply := make(chan planResult, 1)
+	select {
+	case k.planRequests <- reply:
+	case <-time.After(planTimeout):
+		http.Error(w, "No reconciliation loop is running", http.StatusServiceUnavailable)
+		return
+	}
+	result := <-reply
+	if result.err != nil {
+		http.Error(w, result.err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result.plan); err != nil {
+		logging.Errorf("Failed to write plan: %v", err)
+	}
+}
+
+// planResult is the result of a plan request.
+type planResult struct {
+	plan *rebootPlan
+	err  error
+}
+
+// servePlan computes the reboot plan for the given plan request.
+func (k *Kontroller) servePlan(reply chan<- planResult) {
+	plan, err := k.plan()
+	reply <- planResult{plan: plan, err: err}
+}
@@ -0,0 +1,172 @@
+package operator
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/coreos/locksmith/pkg/timeutil"
+	v1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+const (
+	// API group, version and resource of the RebootPolicy custom resource,
+	// as defined in examples/reboot-policy-crd.yaml
+	rebootPolicyGroup    = "container-linux-update.coreos.com"
+	rebootPolicyVersion  = "v1alpha1"
+	rebootPolicyResource = "rebootpolicies"
+)
+
+// rebootPolicy is a RebootPolicy custom resource. Only its spec is used.
+type rebootPolicy struct {
+	Spec rebootPolicySpec `json:"spec"`
+}
+
+// rebootPolicySpec holds the settings of a RebootPolicy, each of which
+// overrides the corresponding flag if set.
+type rebootPolicySpec struct {
+	MaxRebootingNodes  *int   `json:"maxRebootingNodes,omitempty"`
+	MaxUnavailable     string `json:"maxUnavailable,omitempty"`
+	RebootWindowStart  string `json:"rebootWindowStart,omitempty"`
+	RebootWindowLength string `json:"rebootWindowLength,omitempty"`
+	NodeSelector       string `json:"nodeSelector,omitempty"`
+	RebootTimeout      string `json:"rebootTimeout,omitempty"`
+}
+
+// policySettings are the settings of the Kontroller which may be changed by a
+// RebootPolicy.
+type policySettings struct {
+	maxRebootingNodes  int
+	maxUnavailable     *intstr.IntOrString
+	rebootWindow       *timeutil.Periodic
+	policyNodeSelector labels.Selector
+	rebootTimeout      time.Duration
+}
+
+// settings returns the current policy settings of the Kontroller.
+func (k *Kontroller) settings() policySettings {
+	return policySettings{
+		maxRebootingNodes:  k.maxRebootingNodes,
+		maxUnavailable:     k.maxUnavailable,
+		rebootWindow:       k.rebootWindow,
+		policyNodeSelector: k.policyNodeSelector,
+		rebootTimeout:      k.rebootTimeout,
+	}
+}
+
+// applySettings sets the policy settings of the Kontroller.
+func (k *Kontroller) applySettings(s policySettings) {
+	k.maxRebootingNodes = s.maxRebootingNodes
+	k.maxUnavailable = s.maxUnavailable
+	k.rebootWindow = s.rebootWindow
+	k.policyNodeSelector = s.policyNodeSelector
+	k.rebootTimeout = s.rebootTimeout
+}
+
+// loadRebootPolicy gets the configured RebootPolicy in the namespace of the
+// operator and applies its settings over the ones configured by flags, so the
+// policy can be changed without restarting the operator. The flags apply
+// again once the RebootPolicy, or its custom resource definition, is deleted.
+// A RebootPolicy which cannot be read or is invalid is reported, and the
+// settings in effect are kept.
+func (k *Kontroller) loadRebootPolicy() {
+	if k.rebootPolicyName == "" {
+		return
+	}
+
+	raw, err := k.kc.CoreV1().RESTClient().Get().
+		AbsPath("/apis", rebootPolicyGroup, rebootPolicyVersion, "namespaces", k.namespace, rebootPolicyResource, k.rebootPolicyName).
+		DoRaw()
+	if errors.IsNotFound(err) {
+		if k.rebootPolicyLoaded != "" {
+			logging.Infof("RebootPolicy %s/%s not found, using the flags", k.namespace, k.rebootPolicyName)
+			k.rebootPolicyLoaded = ""
+		}
+		k.applySettings(k.flagSettings)
+		return
+	}
+	if err != nil {
+		logging.Errorf("Failed to get RebootPolicy %s/%s: %v", k.namespace, k.rebootPolicyName, err)
+		return
+	}
+
+	// only apply and report each version of the policy once
+	if string(raw) == k.rebootPolicyLoaded {
+		return
+	}
+	var policy rebootPolicy
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		logging.Errorf("Failed to decode RebootPolicy %s/%s: %v", k.namespace, k.rebootPolicyName, err)
+		return
+	}
+	s, err := policy.Spec.settings(k.flagSettings)
+	if err != nil {
+		logging.Errorf("Invalid RebootPolicy %s/%s, keeping the current settings: %v", k.namespace, k.rebootPolicyName, err)
+		k.er.Eventf(k.leaderElectionLockReference(), v1api.EventTypeWarning, eventReasonRebootPolicyInvalid,
+			"Invalid RebootPolicy %s/%s: %v", k.namespace, k.rebootPolicyName, err)
+		k.rebootPolicyLoaded = string(raw)
+		return
+	}
+
+	logging.Infof("Applying RebootPolicy %s/%s", k.namespace, k.rebootPolicyName)
+	k.applySettings(s)
+	k.rebootPolicyLoaded = string(raw)
+}
+
+// settings returns the given settings, configured by flags, with the ones set
+// in the RebootPolicy applied over them.
+func (spec rebootPolicySpec) settings(s policySettings) (policySettings, error) {
+	if spec.MaxRebootingNodes != nil && spec.MaxUnavailable != "" {
+		return s, fmt.Errorf("maxRebootingNodes and maxUnavailable can not be combined")
+	}
+	if spec.MaxRebootingNodes != nil {
+		if *spec.MaxRebootingNodes <= 0 {
+			return s, fmt.Errorf("maxRebootingNodes must be positive, got %d", *spec.MaxRebootingNodes)
+		}
+		s.maxRebootingNodes = *spec.MaxRebootingNodes
+		s.maxUnavailable = nil
+	}
+	if spec.MaxUnavailable != "" {
+		mu, err := parseMaxUnavailable(spec.MaxUnavailable)
+		if err != nil {
+			return s, err
+		}
+		s.maxUnavailable = &mu
+	}
+
+	if (spec.RebootWindowStart == "") != (spec.RebootWindowLength == "") {
+		return s, fmt.Errorf("rebootWindowStart and rebootWindowLength must be set together")
+	}
+	if spec.RebootWindowStart != "" {
+		rw, err := timeutil.ParsePeriodic(spec.RebootWindowStart, spec.RebootWindowLength)
+		if err != nil {
+			return s, fmt.Errorf("Error parsing reboot window: %s", err)
+		}
+		s.rebootWindow = rw
+	}
+
+	if spec.NodeSelector != "" {
+		selector, err := labels.Parse(spec.NodeSelector)
+		if err != nil {
+			return s, fmt.Errorf("Error parsing node selector: %v", err)
+		}
+		s.policyNodeSelector = selector
+	}
+
+	if spec.RebootTimeout != "" {
+		timeout, err := time.ParseDuration(spec.RebootTimeout)
+		if err != nil {
+			return s, fmt.Errorf("Error parsing reboot timeout: %v", err)
+		}
+		if timeout <= 0 {
+			return s, fmt.Errorf("rebootTimeout must be positive, got %v", timeout)
+		}
+		s.rebootTimeout = timeout
+	}
+	return s, nil
+}
@@ -0,0 +1,114 @@
+package operator
+
+import (
+	"fmt"
+
+	v1api "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/k8sutil"
+)
+
+// rebootPredicate is a check a node wanting to reboot must pass before it is
+// chosen to reboot. A node failing a predicate is deferred to a later pass.
+type rebootPredicate interface {
+	// name identifies the predicate in logs and events
+	name() string
+	// check returns why the given node may not reboot yet, or an empty
+	// reason if it may. An error is returned if the check itself failed.
+	check(n *v1api.Node) (string, error)
+}
+
+// rebootPredicates returns the predicates nodes must pass to be chosen to
+// reboot in the current pass, given the PodDisruptionBudgets listed for it:
+// the built-in predicates, followed by the configured reboot predicates, which
+// are aborted once the stop channel is closed.
+func (k *Kontroller) rebootPredicates(pdbs []policy.PodDisruptionBudget, stop <-chan struct{}) []rebootPredicate {
+	var predicates []rebootPredicate
+	if !k.rebootNotReady {
+		predicates = append(predicates, readyPredicate{})
+	}
+	predicates = append(predicates, pdbPredicate{k: k, pdbs: pdbs})
+	if k.protectedPriorityClass != "" {
+		predicates = append(predicates, protectedPriorityPredicate{k: k})
+	}
+	for _, hook := range k.rebootPredicateHooks {
+		predicates = append(predicates, hookPredicate{k: k, hook: hook, stop: stop})
+	}
+	return predicates
+}
+
+// readyPredicate requires the Ready condition of a node to be true.
+type readyPredicate struct{}
+
+func (readyPredicate) name() string { return "ready" }
+
+func (readyPredicate) check(n *v1api.Node) (string, error) {
+	if !k8sutil.NodeReady(n) {
+		return "node is not ready", nil
+	}
+	return "", nil
+}
+
+// pdbPredicate requires the pods of a node to be evictable without violating
+// a PodDisruptionBudget.
+type pdbPredicate struct {
+	k    *Kontroller
+	pdbs []policy.PodDisruptionBudget
+}
+
+func (pdbPredicate) name() string { return "pod-disruption-budget" }
+
+func (p pdbPredicate) check(n *v1api.Node) (string, error) {
+	pdb, err := p.k.blockingPodDisruptionBudget(n, p.pdbs)
+	if err != nil {
+		return "", fmt.Errorf("Failed to check pod disruption budgets for node %q: %v", n.Name, err)
+	}
+	if pdb != nil {
+		return fmt.Sprintf("evicting the pods of this node would violate pod disruption budget %s/%s", pdb.Namespace, pdb.Name), nil
+	}
+	return "", nil
+}
+
+// protectedPriorityPredicate requires a node not to run pods of the protected
+// priority class, or of a higher priority.
+type protectedPriorityPredicate struct {
+	k *Kontroller
+}
+
+func (protectedPriorityPredicate) name() string { return "protected-priority-class" }
+
+func (p protectedPriorityPredicate) check(n *v1api.Node) (string, error) {
+	pod, err := p.k.protectedPod(n)
+	if err != nil {
+		return "", fmt.Errorf("Failed to check protected pods for node %q: %v", n.Name, err)
+	}
+	if pod != nil {
+		return fmt.Sprintf("pod %s/%s has at least the priority of protected priority class %q", pod.Namespace, pod.Name, p.k.protectedPriorityClass), nil
+	}
+	return "", nil
+}
+
+// hookPredicate requires a reboot predicate hook, a command or URL run like
+// the reboot hooks, to succeed for a node within the reboot predicate
+// timeout. The pass is aborted if the stop channel is closed meanwhile.
+type hookPredicate struct {
+	k    *Kontroller
+	hook string
+	stop <-chan struct{}
+}
+
+func (p hookPredicate) name() string { return redactHook(p.hook) }
+
+func (p hookPredicate) check(n *v1api.Node) (string, error) {
+	err := p.k.runHookWithTimeout(p.hook, n.Name, p.k.rebootPredicateTimeout, p.stop)
+	select {
+	case <-p.stop:
+		return "", fmt.Errorf("Stopped while checking predicate %q for node %q", p.name(), n.Name)
+	default:
+	}
+	if err != nil {
+		return err.Error(), nil
+	}
+	return "", nil
+}
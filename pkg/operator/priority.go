@@ -0,0 +1,50 @@
+package operator
+
+import (
+	"fmt"
+
+	v1api "k8s.io/api/core/v1"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/drain"
+)
+
+// protectedPod returns the first pod on the given node which would be evicted
+// by a drain and whose priority is at least the value of the protected
+// PriorityClass, or nil if no PriorityClass is protected or no such pod runs
+// on the node.
+//
+// The value of the PriorityClass is looked up on each call, so changes to it
+// apply without restarting the operator. Pods without a resolved priority,
+// e.g. because the Priority admission controller is disabled, are protected if
+// they name the protected PriorityClass.
+func (k *Kontroller) protectedPod(n *v1api.Node) (*v1api.Pod, error) {
+	if k.protectedPriorityClass == "" {
+		return nil, nil
+	}
+
+	pc, err := k.kc.SchedulingV1alpha1().PriorityClasses().Get(k.protectedPriorityClass, v1meta.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get priority class %q: %v", k.protectedPriorityClass, err)
+	}
+
+	pods, err := drain.GetPodsForDeletion(k.kc, n.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get list of pods on node %q: %v", n.Name, err)
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Spec.Priority == nil {
+			if pod.Spec.PriorityClassName == pc.Name {
+				return pod, nil
+			}
+			continue
+		}
+		if *pod.Spec.Priority >= pc.Value {
+			return pod, nil
+		}
+	}
+
+	return nil, nil
+}
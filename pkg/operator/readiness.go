@@ -0,0 +1,61 @@
+package operator
+
+import (
+	"fmt"
+	"time"
+
+	v1api "k8s.io/api/core/v1"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+// settling returns true if the given node, whose after-reboot annotations are
+// set, is still left to settle for the configured post-reboot delay, counted
+// from when the annotations were first seen set.
+func (k *Kontroller) settling(n *v1api.Node) bool {
+	if k.postRebootDelay == 0 {
+		return false
+	}
+	since, ok := k.afterRebootSettle[n.Name]
+	if !ok {
+		since = time.Now()
+		k.afterRebootSettle[n.Name] = since
+		nodeLog(n).Infof("Leaving node %q to settle for %v after its reboot", n.Name, k.postRebootDelay)
+	}
+	if remaining := k.postRebootDelay - time.Since(since); remaining > 0 {
+		logging.V(4).Infof("Node %q is settling after its reboot for another %v", n.Name, remaining-remaining%time.Second)
+		return true
+	}
+	return false
+}
+
+// unreadyAfterRebootPod returns the first pod on the named node which is
+// selected by the configured after-reboot pod selector and is not ready, or
+// nil if they all are ready or no selector is configured. Pods which are being
+// deleted are ignored.
+func (k *Kontroller) unreadyAfterRebootPod(nodeName string) (*v1api.Pod, error) {
+	if k.afterRebootPodSelector == nil {
+		return nil, nil
+	}
+
+	pods, err := k.kc.CoreV1().Pods(v1api.NamespaceAll).List(v1meta.ListOptions{
+		LabelSelector: k.afterRebootPodSelector.String(),
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed listing after-reboot pods on node %q: %v", nodeName, err)
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if pod.Status.Phase != v1api.PodRunning || !podReady(pod) {
+			return pod, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,126 @@
+package operator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1api "k8s.io/api/core/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+// Policies applied to nodes wanting to reboot, depending on their reboot
+// reason.
+const (
+	// the node reboots like any node
+	reasonPolicyAuto = "auto"
+	// the node reboots once its reboot is approved
+	reasonPolicyApprove = "approve"
+	// the node never reboots
+	reasonPolicyDefer = "defer"
+)
+
+// reasonPolicy is the policy applied to the nodes whose reboot reason starts
+// with prefix.
+type reasonPolicy struct {
+	prefix string
+	policy string
+}
+
+// parseReasonPolicy returns the given reboot reason policy, or
+// reasonPolicyAuto, the default, if the name is empty.
+func parseReasonPolicy(name string) (string, error) {
+	switch name {
+	case "":
+		return reasonPolicyAuto, nil
+	case reasonPolicyAuto, reasonPolicyApprove, reasonPolicyDefer:
+		return name, nil
+	default:
+		return "", fmt.Errorf("unknown reboot reason policy %q, must be %q, %q or %q", name, reasonPolicyAuto, reasonPolicyApprove, reasonPolicyDefer)
+	}
+}
+
+// parseReasonPolicies parses the given reboot reason policies, each of the
+// form "prefix=policy". They are returned longest prefix first, so the most
+// specific policy matching a reason is found first.
+func parseReasonPolicies(specs []string) ([]reasonPolicy, error) {
+	var policies []reasonPolicy
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid reboot reason policy %q, must be of the form prefix=policy", spec)
+		}
+		prefix := spec[:i]
+		if prefix == "" {
+			return nil, fmt.Errorf("invalid reboot reason policy %q: empty reason prefix", spec)
+		}
+		if seen[prefix] {
+			return nil, fmt.Errorf("invalid reboot reason policy %q: duplicate reason prefix %q", spec, prefix)
+		}
+		seen[prefix] = true
+		policy, err := parseReasonPolicy(spec[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, reasonPolicy{prefix: prefix, policy: policy})
+	}
+	sort.SliceStable(policies, func(i, j int) bool {
+		return len(policies[i].prefix) > len(policies[j].prefix)
+	})
+	return policies, nil
+}
+
+// rebootReasonPolicy returns the policy applied to the given node, by its
+// reboot-reason annotation: the policy with the longest prefix of the reason,
+// or the default policy if none matches or the node has no reason.
+func (k *Kontroller) rebootReasonPolicy(n *v1api.Node) string {
+	reason := n.Annotations[constants.AnnotationRebootReason]
+	if reason != "" {
+		for _, p := range k.reasonPolicies {
+			if strings.HasPrefix(reason, p.prefix) {
+				return p.policy
+			}
+		}
+	}
+	return k.defaultReasonPolicy
+}
+
+// applyReasonPolicy returns true if the given node may be chosen to reboot
+// according to the policy for its reboot reason. Nodes whose reason requires
+// approval, and which do not require it already, are annotated with
+// reboot-approval=required, so they are only rebooted once their reboot is
+// approved, as any node requiring approval. The annotation is removed again
+// after the reboot.
+func (k *Kontroller) applyReasonPolicy(n *v1api.Node) (bool, error) {
+	switch k.rebootReasonPolicy(n) {
+	case reasonPolicyDefer:
+		logging.V(4).Infof("Not rebooting node %q: the policy for its reboot reason %q is %q", n.Name, n.Annotations[constants.AnnotationRebootReason], reasonPolicyDefer)
+		return false, nil
+	case reasonPolicyApprove:
+		if _, ok := n.Annotations[constants.AnnotationRebootApproval]; ok {
+			return true, nil
+		}
+		nodeLog(n).Infof("Requiring approval of the reboot of node %q for reason %q", n.Name, n.Annotations[constants.AnnotationRebootReason])
+		err := k.updateNode(n.Name, func(node *v1api.Node) {
+			requireApproval(node)
+		})
+		if err != nil {
+			return false, fmt.Errorf("Failed to require approval of the reboot of node %q: %v", n.Name, err)
+		}
+		requireApproval(n)
+	}
+	return true, nil
+}
+
+// requireApproval requires the reboot of the given node to be approved, if it
+// does not require approval already.
+func requireApproval(node *v1api.Node) {
+	if _, ok := node.Annotations[constants.AnnotationRebootApproval]; ok {
+		return
+	}
+	node.Annotations[constants.AnnotationRebootApproval] = constants.RebootApprovalRequired
+	node.Annotations[constants.AnnotationApprovalRequiredByOperator] = constants.True
+}
@@ -0,0 +1,59 @@
+package operator
+
+import (
+	"fmt"
+	"time"
+
+	v1api "k8s.io/api/core/v1"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+	"github.com/coreos/container-linux-update-operator/pkg/k8sutil"
+)
+
+// RequestReboot requests a reboot of the named node on behalf of its
+// update-agent, by setting reboot-needed to true, so the node is rebooted by
+// the update-operator like any node requesting a reboot, subject to the reboot
+// window, the maximum number of rebooting nodes and the other checks. It
+// returns false if the node already requested a reboot or is rebooting.
+// The label and annotation prefix must be set before, if it is changed.
+func RequestReboot(client kubernetes.Interface, name string) (bool, error) {
+	nc := client.CoreV1().Nodes()
+	node, err := nc.Get(name, v1meta.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("Failed to get node %q: %v", name, err)
+	}
+	if rebootRequested(node) {
+		return false, nil
+	}
+
+	requested := false
+	err = k8sutil.UpdateNodeRetry(nc, name, func(node *v1api.Node) {
+		requested = !rebootRequested(node)
+		if requested {
+			requestReboot(node, "requested manually")
+		}
+	})
+	if err != nil {
+		return false, fmt.Errorf("Failed to request a reboot of node %q: %v", name, err)
+	}
+	return requested, nil
+}
+
+// rebootRequested returns true if the given node already wants to reboot or is
+// rebooting.
+func rebootRequested(n *v1api.Node) bool {
+	return n.Annotations[constants.AnnotationRebootNeeded] == constants.True ||
+		n.Annotations[constants.AnnotationOkToReboot] == constants.True ||
+		n.Annotations[constants.AnnotationRebootInProgress] == constants.True
+}
+
+// requestReboot sets reboot-needed to true on the given node, as its
+// update-agent does when it needs to reboot, for the given reason.
+func requestReboot(node *v1api.Node, reason string) {
+	node.Annotations[constants.AnnotationRebootNeeded] = constants.True
+	node.Annotations[constants.AnnotationRebootNeededTime] = time.Now().UTC().Format(time.RFC3339)
+	node.Annotations[constants.AnnotationRebootReason] = reason
+	node.Labels[constants.LabelRebootNeeded] = constants.True
+}
@@ -0,0 +1,50 @@
+package operator
+
+import (
+	v1api "k8s.io/api/core/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+// rebootOperatorNodeLast returns the given nodes wanting to reboot with the
+// node the operator runs on, if it is one of them, moved last, so it is only
+// considered after all other nodes which may reboot in the current pass.
+func (k *Kontroller) rebootOperatorNodeLast(rebootableNodes []v1api.Node) []v1api.Node {
+	others, self := k.splitOperatorNode(rebootableNodes)
+	if self == nil {
+		return rebootableNodes
+	}
+	return append(others, *self)
+}
+
+// deferOperatorNode reports whether the given node runs the operator and must
+// wait, deferring it, because other nodes are rebooting or were chosen to
+// reboot in the current pass. The node is only rebooted once the others are
+// done, so the operator is not evicted while it coordinates their reboots.
+// Nodes which want to reboot but may not do not hold it back. When the node
+// is drained, the operator is rescheduled, and the new leader resumes its
+// reboot.
+func (k *Kontroller) deferOperatorNode(n *v1api.Node, rebooting, chosen int) bool {
+	if n.Name != k.operatorNode || (rebooting == 0 && chosen == 0) {
+		return false
+	}
+	logging.V(4).Infof("Not rebooting node %q yet: it runs the operator, which reboots it last", n.Name)
+	k.deferNode(n, "runs the operator, waiting for the other nodes to reboot")
+	return true
+}
+
+// splitOperatorNode returns the given nodes without the node the operator runs
+// on, and that node if it is one of them.
+func (k *Kontroller) splitOperatorNode(nodes []v1api.Node) ([]v1api.Node, *v1api.Node) {
+	if k.operatorNode == "" {
+		return nodes, nil
+	}
+	for i := range nodes {
+		if nodes[i].Name == k.operatorNode {
+			self := nodes[i]
+			others := append(append([]v1api.Node(nil), nodes[:i]...), nodes[i+1:]...)
+			return others, &self
+		}
+	}
+	return nodes, nil
+}
@@ -0,0 +1,247 @@
+package operator
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	v1api "k8s.io/api/core/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+	"github.com/coreos/container-linux-update-operator/pkg/k8sutil"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+	"github.com/coreos/container-linux-update-operator/pkg/notifier"
+)
+
+// operatorStatus is the view of the update-operator on the reboots of the
+// cluster, as served by the status endpoint.
+type operatorStatus struct {
+	// whether this operator holds the leader election lock. Only the leader
+	// reconciles, so the status of other operators is not updated.
+	Leading bool `json:"leading"`
+	// time of the reconciliation pass the nodes below were recorded in
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	// names of the nodes which want to reboot and have not been allowed to
+	NodesWantingReboot []string `json:"nodesWantingReboot"`
+	// names of the nodes wanting to reboot which are waiting for their reboot
+	// to be approved. They are included in the nodes wanting to reboot.
+	NodesAwaitingApproval []string `json:"nodesAwaitingApproval"`
+	// nodes wanting to reboot which were not chosen to reboot in the last
+	// pass, and why
+	NodesDeferred []deferredNodeStatus `json:"nodesDeferred"`
+	// nodes which are being rebooted, including their checks
+	NodesRebooting []rebootingNodeStatus `json:"nodesRebooting"`
+	// time the last reboot completed, the number of reboots completed and
+	// the number of reboots which failed since this operator started
+	LastRebootCompleted *time.Time `json:"lastRebootCompleted,omitempty"`
+	RebootsCompleted    int        `json:"rebootsCompleted"`
+	RebootFailures      int        `json:"rebootFailures"`
+	// number of reboots which failed in a row, and whether reboots are halted
+	// because too many did
+	ConsecutiveRebootFailures int  `json:"consecutiveRebootFailures"`
+	RebootsHalted             bool `json:"rebootsHalted"`
+	// reboot freeze in effect, during which no node may reboot, if any
+	RebootFreeze string `json:"rebootFreeze,omitempty"`
+	// last few reboots of each node which completed or failed since this
+	// operator started, most recent first, keyed by node name
+	RebootHistory map[string][]rebootRecord `json:"rebootHistory"`
+}
+
+// rebootHistoryLength is the number of reboots kept in the history of each
+// node.
+const rebootHistoryLength = 5
+
+// rebootRecord is a reboot of a node which completed or failed.
+type rebootRecord struct {
+	// time the reboot completed or was reported as failed
+	Time      time.Time `json:"time"`
+	Succeeded bool      `json:"succeeded"`
+	// time the node was allowed to reboot, if known
+	RebootStarted *time.Time `json:"rebootStarted,omitempty"`
+	// reason the reboot was needed, if known
+	Reason string `json:"reason,omitempty"`
+}
+
+// rebootingNodeStatus is the status of a node being rebooted.
+type rebootingNodeStatus struct {
+	Name  string `json:"name"`
+	Phase string `json:"phase,omitempty"`
+	// time the node was allowed to reboot, if it has been
+	RebootStarted *time.Time `json:"rebootStarted,omitempty"`
+	// reason the reboot is needed, if known
+	Reason string `json:"reason,omitempty"`
+}
+
+// deferredNodeStatus is the status of a node wanting to reboot which was not
+// chosen to reboot.
+type deferredNodeStatus struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// recordNodeStatus records the nodes wanting to reboot and being rebooted in
+// the status, from the nodes listed during the current reconciliation pass.
+func (k *Kontroller) recordNodeStatus() {
+	nodelist, err := k.listPassNodes()
+	if err != nil {
+		logging.Errorf("Failed listing nodes to record the status: %v", err)
+		return
+	}
+
+	wanting := []string{}
+	awaitingApproval := []string{}
+	deferred := []deferredNodeStatus{}
+	wantsRebootNodes := k8sutil.FilterNodesByAnnotation(nodelist.Items, wantsRebootSelector)
+	for _, n := range k8sutil.FilterNodesByRequirement(wantsRebootNodes, notBeforeRebootReq) {
+		wanting = append(wanting, n.Name)
+		if n.Annotations[constants.AnnotationRebootApproval] == constants.RebootApprovalRequired {
+			awaitingApproval = append(awaitingApproval, n.Name)
+		}
+		if reason := k.deferredReasonOf(n.Name); reason != "" {
+			deferred = append(deferred, deferredNodeStatus{Name: n.Name, Reason: reason})
+		}
+	}
+	sort.Strings(wanting)
+	sort.Strings(awaitingApproval)
+	sort.Slice(deferred, func(i, j int) bool { return deferred[i].Name < deferred[j].Name })
+
+	// the same nodes markBeforeReboot considers to be rebooting
+	rebootingNodes := k8sutil.FilterNodesByAnnotation(nodelist.Items, stillRebootingSelector)
+	rebootingNodes = append(rebootingNodes, k8sutil.FilterNodesByRequirement(nodelist.Items, beforeRebootReq)...)
+	rebootingNodes = append(rebootingNodes, k8sutil.FilterNodesByRequirement(nodelist.Items, afterRebootReq)...)
+	rebooting := []rebootingNodeStatus{}
+	seen := make(map[string]bool)
+	for i := range rebootingNodes {
+		n := &rebootingNodes[i]
+		if seen[n.Name] {
+			continue
+		}
+		seen[n.Name] = true
+		s := rebootingNodeStatus{
+			Name:   n.Name,
+			Phase:  n.Annotations[constants.AnnotationRebootPhase],
+			Reason: n.Annotations[constants.AnnotationRebootReason],
+		}
+		if started, ok := rebootStartTime(n); ok {
+			s.RebootStarted = &started
+		}
+		rebooting = append(rebooting, s)
+	}
+	sort.Slice(rebooting, func(i, j int) bool { return rebooting[i].Name < rebooting[j].Name })
+
+	now := time.Now().UTC()
+	k.statusMu.Lock()
+	defer k.statusMu.Unlock()
+	k.status.UpdatedAt = &now
+	k.status.NodesWantingReboot = wanting
+	k.status.NodesAwaitingApproval = awaitingApproval
+	k.status.NodesDeferred = deferred
+	k.status.NodesRebooting = rebooting
+}
+
+// rebootSucceeded records a completed reboot of the given node.
+func (k *Kontroller) rebootSucceeded(n *v1api.Node) {
+	rebootsTotal.Inc()
+	k.lastRebootCompleted = time.Now()
+	k.consecutiveRebootFailures = 0
+	rebootsHaltedGauge.Set(0)
+
+	completed := k.lastRebootCompleted.UTC()
+	k.statusMu.Lock()
+	defer k.statusMu.Unlock()
+	k.status.RebootsCompleted++
+	k.status.LastRebootCompleted = &completed
+	k.status.ConsecutiveRebootFailures = 0
+	k.status.RebootsHalted = false
+	k.recordReboot(n, true)
+}
+
+// rebootFailed records a failed reboot of the given node.
+func (k *Kontroller) rebootFailed(n *v1api.Node) {
+	rebootFailuresTotal.Inc()
+	k.countRebootFailure(n)
+
+	k.statusMu.Lock()
+	defer k.statusMu.Unlock()
+	k.status.RebootFailures++
+	k.status.ConsecutiveRebootFailures = k.consecutiveRebootFailures
+	k.status.RebootsHalted = k.rebootsHalted()
+	k.recordReboot(n, false)
+}
+
+// recordReboot adds a completed or failed reboot of the given node to its
+// reboot history, dropping its oldest reboots beyond the history length.
+// statusMu must be held.
+func (k *Kontroller) recordReboot(n *v1api.Node, succeeded bool) {
+	r := rebootRecord{
+		Time:      time.Now().UTC(),
+		Succeeded: succeeded,
+		Reason:    n.Annotations[constants.AnnotationRebootReason],
+	}
+	if started, ok := rebootStartTime(n); ok {
+		r.RebootStarted = &started
+	}
+	k.postRebootResult(n.Name, r)
+
+	if k.status.RebootHistory == nil {
+		k.status.RebootHistory = make(map[string][]rebootRecord)
+	}
+	history := append([]rebootRecord{r}, k.status.RebootHistory[n.Name]...)
+	if len(history) > rebootHistoryLength {
+		history = history[:rebootHistoryLength]
+	}
+	k.status.RebootHistory[n.Name] = history
+}
+
+// postRebootResult queues the given reboot of the named node for delivery to
+// the result webhook, if configured.
+func (k *Kontroller) postRebootResult(name string, r rebootRecord) {
+	if k.results == nil {
+		return
+	}
+	outcome := notifier.OutcomeSucceeded
+	if !r.Succeeded {
+		outcome = notifier.OutcomeFailed
+	}
+	k.results.Add(notifier.Result{
+		Cluster:  k.clusterName,
+		Node:     name,
+		Started:  r.RebootStarted,
+		Finished: r.Time,
+		Outcome:  outcome,
+		Reason:   r.Reason,
+	})
+}
+
+// statusHandler serves the status of the operator as JSON.
+func (k *Kontroller) statusHandler(w http.ResponseWriter, r *http.Request) {
+	k.statusMu.Lock()
+	status := k.status
+	// the histories are replaced, never modified, so copying the map is
+	// enough to encode it without holding the lock
+	status.RebootHistory = make(map[string][]rebootRecord, len(k.status.RebootHistory))
+	for name, history := range k.status.RebootHistory {
+		status.RebootHistory[name] = history
+	}
+	k.statusMu.Unlock()
+	status.Leading = atomic.LoadInt32(&k.leading) == 1
+	if status.NodesWantingReboot == nil {
+		status.NodesWantingReboot = []string{}
+	}
+	if status.NodesAwaitingApproval == nil {
+		status.NodesAwaitingApproval = []string{}
+	}
+	if status.NodesDeferred == nil {
+		status.NodesDeferred = []deferredNodeStatus{}
+	}
+	if status.NodesRebooting == nil {
+		status.NodesRebooting = []rebootingNodeStatus{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logging.Errorf("Failed to write status: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package operator
+
+import (
+	"fmt"
+	"time"
+
+	v1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+	"github.com/coreos/container-linux-update-operator/pkg/k8sutil"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+// rebootStrategy returns the reboot strategy of the given node, as set by the
+// reboot-strategy annotation. Nodes without the annotation use the reboot
+// strategy. Nodes with an unknown strategy are never rebooted, as we cannot
+// know how the administrator wanted them to be rebooted.
+func rebootStrategy(n *v1api.Node) string {
+	strategy, ok := n.Annotations[constants.AnnotationRebootStrategy]
+	if !ok || strategy == "" {
+		return constants.RebootStrategyReboot
+	}
+
+	switch strategy {
+	case constants.RebootStrategyReboot, constants.RebootStrategyEtcdLock, constants.RebootStrategyOff:
+		return strategy
+	default:
+		nodeLog(n).Warningf("Node %q has unknown reboot strategy %q, not rebooting it", n.Name, strategy)
+		return constants.RebootStrategyOff
+	}
+}
+
+// parseRebootStrategy returns the reboot strategy of the operator, which is
+// either RebootStrategyReboot, the default if the name is empty, or
+// RebootStrategyOff.
+func parseRebootStrategy(name string) (string, error) {
+	switch name {
+	case "", constants.RebootStrategyReboot:
+		return constants.RebootStrategyReboot, nil
+	case constants.RebootStrategyOff:
+		return constants.RebootStrategyOff, nil
+	default:
+		return "", fmt.Errorf("unknown reboot strategy %q, must be %q or %q", name, constants.RebootStrategyReboot, constants.RebootStrategyOff)
+	}
+}
+
+// reportNodesWantingReboot updates the number of nodes wanting to reboot, when
+// markBeforeReboot does not run.
+func (k *Kontroller) reportNodesWantingReboot() error {
+	nodelist, err := k.listPassNodes()
+	if err != nil {
+		return fmt.Errorf("Failed listing nodes: %v", err)
+	}
+	rebootableNodes := k8sutil.FilterNodesByAnnotation(nodelist.Items, wantsRebootSelector)
+	rebootableNodes = k8sutil.FilterNodesByRequirement(rebootableNodes, notBeforeRebootReq)
+	k.recordRebootBacklog(len(rebootableNodes))
+	return nil
+}
+
+// hostsEtcd returns true if the given node matches the configured etcd node
+// selector, i.e. it hosts an etcd member. No node hosts etcd if no selector
+// is configured.
+func (k *Kontroller) hostsEtcd(n *v1api.Node) bool {
+	return k.etcdNodeSelector != nil && k.etcdNodeSelector.Matches(labels.Set(n.Labels))
+}
+
+// rebootRequestExpired returns true if the reboot request of the given node is
+// older than the configured reboot request TTL, so it is ignored. Each expired
+// request is reported once, with a RebootRequestExpired event.
+func (k *Kontroller) rebootRequestExpired(n *v1api.Node) bool {
+	if k.rebootRequestTTL == 0 {
+		return false
+	}
+	requested, ok := rebootRequestTime(n)
+	if !ok || time.Since(requested) <= k.rebootRequestTTL {
+		delete(k.expiredRebootRequests, n.Name)
+		return false
+	}
+
+	value := n.Annotations[constants.AnnotationRebootNeededTime]
+	if k.expiredRebootRequests[n.Name] != value {
+		k.expiredRebootRequests[n.Name] = value
+		nodeLog(n).With("reason", eventReasonRebootRequestExpired).Infof("Ignoring reboot request of node %q: it was requested at %s, more than %v ago", n.Name, value, k.rebootRequestTTL)
+		k.er.Eventf(n, v1api.EventTypeWarning, eventReasonRebootRequestExpired,
+			"Reboot request ignored: requested at %s, more than %v ago", value, k.rebootRequestTTL)
+	}
+	return true
+}
+
+// awaitingApproval returns true if the given node requires its reboots to be
+// approved and its reboot has not been approved yet. Each node awaiting
+// approval is reported once, with a RebootDeferred event.
+func (k *Kontroller) awaitingApproval(n *v1api.Node) bool {
+	if n.Annotations[constants.AnnotationRebootApproval] != constants.RebootApprovalRequired {
+		delete(k.awaitingApprovalReported, n.Name)
+		return false
+	}
+
+	if !k.awaitingApprovalReported[n.Name] {
+		k.awaitingApprovalReported[n.Name] = true
+		nodeLog(n).With("reason", eventReasonRebootDeferred).Infof("Not rebooting node %q until its reboot is approved", n.Name)
+		k.er.Eventf(n, v1api.EventTypeNormal, eventReasonRebootDeferred,
+			"Reboot deferred: waiting for approval, by setting %q to %q", constants.AnnotationRebootApproval, constants.RebootApprovalGranted)
+	}
+	return true
+}
+
+// resetApproval requires the next reboot of the given node to be approved
+// again, if its current reboot was approved. If the approval was only
+// required for the reason of its current reboot, it is no longer required.
+func resetApproval(node *v1api.Node) {
+	if node.Annotations[constants.AnnotationApprovalRequiredByOperator] == constants.True {
+		delete(node.Annotations, constants.AnnotationRebootApproval)
+		delete(node.Annotations, constants.AnnotationApprovalRequiredByOperator)
+		return
+	}
+	if node.Annotations[constants.AnnotationRebootApproval] == constants.RebootApprovalGranted {
+		node.Annotations[constants.AnnotationRebootApproval] = constants.RebootApprovalRequired
+	}
+}
+
+// rebootTimeoutOf returns the time the given node is given to complete its
+// reboot: the duration of its reboot-timeout annotation, or the configured
+// reboot timeout if it has none or it is not a positive duration.
+func (k *Kontroller) rebootTimeoutOf(n *v1api.Node) time.Duration {
+	value, ok := n.Annotations[constants.AnnotationRebootTimeout]
+	if !ok {
+		return k.rebootTimeout
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		nodeLog(n).Warningf("Node %q has invalid reboot timeout %q, using %v", n.Name, value, k.rebootTimeout)
+		return k.rebootTimeout
+	}
+	logging.V(4).Infof("Using reboot timeout %v of node %q", timeout, n.Name)
+	return timeout
+}
@@ -0,0 +1,74 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+
+	v1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+// parseRebootTaint parses a reboot taint of the form "key=value" or "key"
+// into a NoSchedule taint, or returns nil if the string is empty.
+func parseRebootTaint(s string) (*v1api.Taint, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	taint := &v1api.Taint{Effect: v1api.TaintEffectNoSchedule}
+	parts := strings.SplitN(s, "=", 2)
+	taint.Key = parts[0]
+	if len(parts) == 2 {
+		taint.Value = parts[1]
+	}
+
+	if errs := validation.IsQualifiedName(taint.Key); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid reboot taint key %q: %s", taint.Key, strings.Join(errs, "; "))
+	}
+	if taint.Value != "" {
+		if errs := validation.IsValidLabelValue(taint.Value); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid reboot taint value %q: %s", taint.Value, strings.Join(errs, "; "))
+		}
+	}
+	return taint, nil
+}
+
+// taintNode adds the given taint to the node, so only pods tolerating it are
+// scheduled on it while it reboots. A node tainted by taintNode is annotated
+// with the key of the taint, so the taint is removed after the reboot, even if
+// the operator restarted or its reboot taint changed in the meantime. Nodes
+// which already have a taint with the same key were tainted by someone else,
+// and are left alone.
+func taintNode(node *v1api.Node, taint *v1api.Taint) {
+	for _, t := range node.Spec.Taints {
+		if t.Key == taint.Key && t.Effect == taint.Effect {
+			return
+		}
+	}
+	logging.V(4).Infof("Adding taint %q to node %q", taint.ToString(), node.Name)
+	node.Spec.Taints = append(node.Spec.Taints, *taint)
+	node.Annotations[constants.AnnotationTaintedByOperator] = taint.Key
+}
+
+// untaintIfTaintedByOperator removes the reboot taint from the given node if it
+// was added by the update-operator. Taints added by anyone else are left
+// alone.
+func untaintIfTaintedByOperator(node *v1api.Node) {
+	key, ok := node.Annotations[constants.AnnotationTaintedByOperator]
+	if !ok {
+		return
+	}
+	logging.V(4).Infof("Removing taint %q from node %q", key, node.Name)
+	taints := node.Spec.Taints[:0]
+	for _, t := range node.Spec.Taints {
+		if t.Key == key && t.Effect == v1api.TaintEffectNoSchedule {
+			continue
+		}
+		taints = append(taints, t)
+	}
+	node.Spec.Taints = taints
+	delete(node.Annotations, constants.AnnotationTaintedByOperator)
+}
@@ -0,0 +1,79 @@
+package operator
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+const (
+	// upgradeNamespace is the namespace whose annotation signals a cluster
+	// upgrade in progress.
+	upgradeNamespace = "kube-system"
+	// upgradeConfigMapKey is the key of the upgrade ConfigMap which signals
+	// a cluster upgrade in progress when set to "true".
+	upgradeConfigMapKey = "upgrade-in-progress"
+)
+
+// parseUpgradeConfigMap returns the namespace and name of the upgrade
+// ConfigMap, given as "namespace/name", or empty strings if none is given.
+func parseUpgradeConfigMap(s string) (string, string, error) {
+	if s == "" {
+		return "", "", nil
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid upgrade ConfigMap %q, must be of the form namespace/name", s)
+	}
+	return parts[0], parts[1], nil
+}
+
+// upgradeInProgress returns true if a cluster upgrade is signalled to be in
+// progress, by the configured annotation of the kube-system namespace or key
+// of the upgrade ConfigMap being set to "true". Missing namespaces and
+// ConfigMaps signal no upgrade. The start and end of each upgrade are logged.
+func (k *Kontroller) upgradeInProgress() (bool, error) {
+	upgrading, source, err := k.upgradeSignal()
+	if err != nil {
+		return false, err
+	}
+	if upgrading != k.upgrading {
+		if upgrading {
+			logging.Infof("Cluster upgrade in progress, signalled by %s: not allowing any node to reboot until it completes", source)
+		} else {
+			logging.Infof("Cluster upgrade completed, allowing nodes to reboot again")
+		}
+		k.upgrading = upgrading
+	}
+	return upgrading, nil
+}
+
+// upgradeSignal returns whether any of the configured signals is set, and
+// which one.
+func (k *Kontroller) upgradeSignal() (bool, string, error) {
+	if k.upgradeAnnotation != "" {
+		ns, err := k.kc.CoreV1().Namespaces().Get(upgradeNamespace, v1meta.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return false, "", fmt.Errorf("Failed to get namespace %q: %v", upgradeNamespace, err)
+		}
+		if err == nil && ns.Annotations[k.upgradeAnnotation] == constants.True {
+			return true, fmt.Sprintf("annotation %q of namespace %q", k.upgradeAnnotation, upgradeNamespace), nil
+		}
+	}
+
+	if k.upgradeConfigMapName != "" {
+		cm, err := k.kc.CoreV1().ConfigMaps(k.upgradeConfigMapNamespace).Get(k.upgradeConfigMapName, v1meta.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return false, "", fmt.Errorf("Failed to get ConfigMap %s/%s: %v", k.upgradeConfigMapNamespace, k.upgradeConfigMapName, err)
+		}
+		if err == nil && cm.Data[upgradeConfigMapKey] == constants.True {
+			return true, fmt.Sprintf("key %q of ConfigMap %s/%s", upgradeConfigMapKey, k.upgradeConfigMapNamespace, k.upgradeConfigMapName), nil
+		}
+	}
+	return false, "", nil
+}
@@ -0,0 +1,178 @@
+package operator
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v1api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+	"github.com/coreos/container-linux-update-operator/pkg/logging"
+)
+
+const (
+	// watchRetryPeriod is how long to wait before re-establishing a node
+	// watch which failed to start.
+	watchRetryPeriod = 5 * time.Second
+)
+
+// watchNodes watches the managed nodes and requests a reconciliation on the
+// trigger channel whenever the update-operator state of a node changes, until
+// the stop channel is closed.
+//
+// The watch is only used to react to changes quickly. Reconciliation still
+// lists the nodes itself, so its decisions are never based on a stale view of
+// the cluster.
+//
+// When the watch is closed, e.g. because the apiserver restarted, it is
+// resumed from the last seen resource version, so no changes are missed. If
+// that resource version has expired, either when the watch is started or
+// while it runs, the watch is restarted from the current state of the nodes
+// instead, and every node is considered changed.
+func (k *Kontroller) watchNodes(trigger chan<- struct{}, stop <-chan struct{}) {
+	// last seen update-operator state of each node, used to ignore updates
+	// which do not concern us, such as node status heartbeats.
+	seen := make(map[string]string)
+	// resource version to resume the watch from, or empty to start from the
+	// current state of the nodes
+	resourceVersion := ""
+
+	// ask the apiserver to end the watch well before the client times out,
+	// so it is resumed cleanly instead of failing
+	var timeoutSeconds *int64
+	if k.clientTimeout > 0 {
+		seconds := int64(k.clientTimeout.Seconds() / 2)
+		if seconds < 1 {
+			seconds = 1
+		}
+		timeoutSeconds = &seconds
+	}
+
+	for {
+		w, err := k.nc.Watch(v1meta.ListOptions{
+			LabelSelector:   k.nodeSelector.String(),
+			ResourceVersion: resourceVersion,
+			TimeoutSeconds:  timeoutSeconds,
+		})
+		if err != nil {
+			logging.Errorf("Failed to watch nodes: %v", err)
+			if resourceVersionExpired(err) {
+				resourceVersion = ""
+				seen = make(map[string]string)
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(watchRetryPeriod):
+			}
+			continue
+		}
+
+		if !k.handleNodeEvents(w, seen, &resourceVersion, trigger, stop) {
+			w.Stop()
+			return
+		}
+		w.Stop()
+		if resourceVersion == "" {
+			seen = make(map[string]string)
+		}
+		logging.V(4).Infof("Node watch closed, resuming from resource version %q", resourceVersion)
+	}
+}
+
+// handleNodeEvents consumes the events of the given watch until it is closed,
+// in which case true is returned, or the stop channel is closed, in which
+// case false is returned. The resource version of the last seen node is
+// recorded in resourceVersion, and reset on error events.
+func (k *Kontroller) handleNodeEvents(w watch.Interface, seen map[string]string, resourceVersion *string, trigger chan<- struct{}, stop <-chan struct{}) bool {
+	for {
+		select {
+		case <-stop:
+			return false
+		case ev, ok := <-w.ResultChan():
+			if !ok {
+				return true
+			}
+
+			if ev.Type == watch.Error {
+				// most likely an expired resource version. the watch is
+				// closed afterwards and restarted from the current state.
+				logging.V(4).Infof("Node watch failed, restarting it: %v", errors.FromObject(ev.Object))
+				*resourceVersion = ""
+				continue
+			}
+
+			node, ok := ev.Object.(*v1api.Node)
+			if !ok {
+				logging.V(4).Infof("Unexpected node watch event %v: %#v", ev.Type, ev.Object)
+				continue
+			}
+			*resourceVersion = node.ResourceVersion
+			if !k.managesNode(node.Name) {
+				continue
+			}
+
+			var changed bool
+			switch ev.Type {
+			case watch.Deleted:
+				_, changed = seen[node.Name]
+				delete(seen, node.Name)
+			case watch.Added, watch.Modified:
+				state := nodeState(node)
+				changed = seen[node.Name] != state
+				seen[node.Name] = state
+			}
+
+			if changed {
+				logging.V(4).Infof("Update-operator state of node %q changed, requesting reconciliation", node.Name)
+				requestReconcile(trigger)
+			}
+		}
+	}
+}
+
+// resourceVersionExpired returns true if the given error reports that the
+// requested resource version is too old to be watched from.
+func resourceVersionExpired(err error) bool {
+	status, ok := err.(errors.APIStatus)
+	if !ok {
+		return false
+	}
+	s := status.Status()
+	return s.Code == http.StatusGone || s.Reason == v1meta.StatusReasonGone || s.Reason == v1meta.StatusReasonExpired
+}
+
+// requestReconcile requests a reconciliation without blocking. Requests made
+// while one is already pending are coalesced.
+func requestReconcile(trigger chan<- struct{}) {
+	select {
+	case trigger <- struct{}{}:
+	default:
+	}
+}
+
+// nodeState returns a string representation of the parts of a node the
+// update-operator acts upon: its update-operator labels and annotations and
+// whether it is schedulable.
+func nodeState(node *v1api.Node) string {
+	var state []string
+	for k, v := range node.Labels {
+		if strings.HasPrefix(k, constants.Prefix) {
+			state = append(state, "label:"+k+"="+v)
+		}
+	}
+	for k, v := range node.Annotations {
+		if strings.HasPrefix(k, constants.Prefix) {
+			state = append(state, "annotation:"+k+"="+v)
+		}
+	}
+	sort.Strings(state)
+	state = append(state, "unschedulable="+strconv.FormatBool(node.Spec.Unschedulable))
+	return strings.Join(state, ",")
+}
@@ -0,0 +1,34 @@
+package operator
+
+import (
+	"strconv"
+
+	v1api "k8s.io/api/core/v1"
+
+	"github.com/coreos/container-linux-update-operator/pkg/constants"
+)
+
+// rebootWeight returns the share of the maximum number of rebooting nodes the
+// reboot of the given node uses: the value of its reboot-weight annotation,
+// or 1 if it has none or it is not a positive integer.
+func rebootWeight(n *v1api.Node) int {
+	value, ok := n.Annotations[constants.AnnotationRebootWeight]
+	if !ok {
+		return 1
+	}
+	weight, err := strconv.Atoi(value)
+	if err != nil || weight <= 0 {
+		nodeLog(n).Warningf("Node %q has invalid reboot weight %q, using 1", n.Name, value)
+		return 1
+	}
+	return weight
+}
+
+// totalRebootWeight returns the sum of the reboot weights of the given nodes.
+func totalRebootWeight(nodes []v1api.Node) int {
+	var total int
+	for i := range nodes {
+		total += rebootWeight(&nodes[i])
+	}
+	return total
+}
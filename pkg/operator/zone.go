@@ -0,0 +1,21 @@
+package operator
+
+import (
+	v1api "k8s.io/api/core/v1"
+)
+
+const (
+	// labels of the zone of a node, in the order they are looked up. The
+	// beta label is set by older clusters.
+	labelZone     = "topology.kubernetes.io/zone"
+	labelZoneBeta = "failure-domain.beta.kubernetes.io/zone"
+)
+
+// nodeZone returns the zone of the given node, or an empty string if the node
+// is not labeled with a zone.
+func nodeZone(n *v1api.Node) string {
+	if zone := n.Labels[labelZone]; zone != "" {
+		return zone
+	}
+	return n.Labels[labelZoneBeta]
+}
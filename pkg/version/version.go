@@ -28,6 +28,12 @@ func init() {
 	Semver = v
 }
 
+// Build returns the version of this code with the commit it was built from as
+// semver build metadata, e.g. "0.7.0+a1b2c3d".
+func Build() string {
+	return fmt.Sprintf("%s+%s", Version, Commit)
+}
+
 func Format() string {
 	return fmt.Sprintf("Version: %s\nCommit: %s", Version, Commit)
 }